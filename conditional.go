@@ -0,0 +1,99 @@
+package roboot
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// etagMatch check whether the etag matches any of the comma separated list, weak
+// comparison ignores the W/ prefix.
+func etagMatch(list, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	if !weak && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "*" {
+			return true
+		}
+		if strings.HasPrefix(item, "W/") {
+			if !weak {
+				continue
+			}
+			item = item[2:]
+		}
+		if item == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// modifiedSince report whether modTime is after the time in header, invalid header
+// is reported by the second result and should be ignored.
+func modifiedSince(header string, modTime time.Time) (bool, bool) {
+	t, err := http.ParseTime(header)
+	if err != nil {
+		return false, false
+	}
+	return modTime.Truncate(time.Second).After(t), true
+}
+
+// CheckModified set ETag and Last-Modified headers if they are not empty, then evaluate
+// conditional request headers. It returns false if 304 or 412 status has been written,
+// and the handler should return immediately.
+func (ctx *Context) CheckModified(etag string, modTime time.Time) bool {
+	var (
+		headers    = ctx.Resp.Header()
+		reqHeaders = ctx.Req.Header
+		hasModTime = !modTime.IsZero() && !modTime.Equal(time.Unix(0, 0))
+		isGetHead  = ctx.Req.Method == MethodGet || ctx.Req.Method == MethodHead
+	)
+	if etag != "" {
+		headers.Set(HeaderETag, etag)
+	}
+	if hasModTime {
+		headers.Set(HeaderLastModified, modTime.UTC().Format(http.TimeFormat))
+	}
+
+	if ifMatch := reqHeaders.Get(HeaderIfMatch); ifMatch != "" {
+		if !etagMatch(ifMatch, etag, false) {
+			ctx.Status(http.StatusPreconditionFailed)
+			return false
+		}
+	} else if since := reqHeaders.Get(HeaderIfUnmodifiedSince); since != "" && hasModTime {
+		if modified, valid := modifiedSince(since, modTime); valid && modified {
+			ctx.Status(http.StatusPreconditionFailed)
+			return false
+		}
+	}
+
+	if ifNoneMatch := reqHeaders.Get(HeaderIfNoneMatch); ifNoneMatch != "" {
+		if etagMatch(ifNoneMatch, etag, true) {
+			if isGetHead {
+				ctx.notModified()
+			} else {
+				ctx.Status(http.StatusPreconditionFailed)
+			}
+			return false
+		}
+	} else if since := reqHeaders.Get(HeaderIfModifiedSince); since != "" && hasModTime && isGetHead {
+		if modified, valid := modifiedSince(since, modTime); valid && !modified {
+			ctx.notModified()
+			return false
+		}
+	}
+	return true
+}
+
+func (ctx *Context) notModified() {
+	headers := ctx.Resp.Header()
+	headers.Del(HeaderContentType)
+	headers.Del(HeaderContentLength)
+	ctx.Status(http.StatusNotModified)
+}
@@ -7,6 +7,15 @@ const (
 	HeaderContentType     = "Content-Type"
 	HeaderContentLength   = "Content-Length"
 	HeaderUserAgent       = "User-Agent"
+	HeaderHost            = "Host"
+
+	HeaderForwarded           = "Forwarded"
+	HeaderXForwardedFor       = "X-Forwarded-For"
+	HeaderXForwardedProto     = "X-Forwarded-Proto"
+	HeaderXForwardedHost      = "X-Forwarded-Host"
+	HeaderXRealIP             = "X-Real-IP"
+	HeaderXRequestID          = "X-Request-ID"
+	HeaderXHTTPMethodOverride = "X-HTTP-Method-Override"
 
 	HeaderAuthorization = "Authorization"
 
@@ -16,15 +25,56 @@ const (
 	HeaderOrigin = "Origin"
 
 	// CORS
-	HeaderCorsRequestMethod  = "Access-Control-Request-Method"
-	HeaderCorsRequestHeaders = "Access-Control-Request-Headers"
-
-	HeaderCorsAllowOrigin = "Access-Control-Allow-Origin"
-	HeaderCorsAllowCredentials = "Access-Control-Allow-Credentials"
-	HeaderCorsAllowHeaders     = "Access-Control-Allow-Headers"
-	HeaderCorsAllowMethods     = "Access-Control-Allow-Methods"
-	HeaderCorsExposeHeaders    = "Access-Control-Expose-Headers"
-	HeaderCorsMaxAge           = "Access-Control-Max-Age"
+	HeaderCorsRequestMethod         = "Access-Control-Request-Method"
+	HeaderCorsRequestHeaders        = "Access-Control-Request-Headers"
+	HeaderCorsRequestPrivateNetwork = "Access-Control-Request-Private-Network"
+
+	HeaderCorsAllowOrigin         = "Access-Control-Allow-Origin"
+	HeaderCorsAllowCredentials    = "Access-Control-Allow-Credentials"
+	HeaderCorsAllowHeaders        = "Access-Control-Allow-Headers"
+	HeaderCorsAllowMethods        = "Access-Control-Allow-Methods"
+	HeaderCorsExposeHeaders       = "Access-Control-Expose-Headers"
+	HeaderCorsMaxAge              = "Access-Control-Max-Age"
+	HeaderCorsAllowPrivateNetwork = "Access-Control-Allow-Private-Network"
+
+	// Rate limit
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRetryAfter         = "Retry-After"
+
+	// Caching
+	HeaderCacheControl = "Cache-Control"
+	HeaderVary         = "Vary"
+	HeaderAge          = "Age"
+	HeaderSetCookie    = "Set-Cookie"
+
+	// Idempotency
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	// Conditional request
+	HeaderETag              = "ETag"
+	HeaderLastModified      = "Last-Modified"
+	HeaderIfMatch           = "If-Match"
+	HeaderIfNoneMatch       = "If-None-Match"
+	HeaderIfModifiedSince   = "If-Modified-Since"
+	HeaderIfUnmodifiedSince = "If-Unmodified-Since"
+
+	// Security
+	HeaderStrictTransportSecurity         = "Strict-Transport-Security"
+	HeaderContentSecurityPolicy           = "Content-Security-Policy"
+	HeaderContentSecurityPolicyReportOnly = "Content-Security-Policy-Report-Only"
+	HeaderXFrameOptions                   = "X-Frame-Options"
+	HeaderXContentTypeOptions             = "X-Content-Type-Options"
+	HeaderReferrerPolicy                  = "Referrer-Policy"
+	HeaderPermissionsPolicy               = "Permissions-Policy"
+	HeaderCrossOriginOpenerPolicy         = "Cross-Origin-Opener-Policy"
+	HeaderCrossOriginEmbedderPolicy       = "Cross-Origin-Embedder-Policy"
+
+	// W3C Trace Context
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
 )
 
 const (
@@ -38,3 +88,11 @@ const (
 	MethodConnect = "CONNECT"
 	MethodTrace   = "TRACE"
 )
+
+const (
+	// ContextValueCSPNonce is the context value name of per-request CSP nonce
+	ContextValueCSPNonce = "roboot.CSPNonce"
+	// ContextValuePrincipal is the context value name of authenticated caller identity,
+	// it should be set by authentication filters as string
+	ContextValuePrincipal = "roboot.Principal"
+)
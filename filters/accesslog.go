@@ -0,0 +1,161 @@
+package filters
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cosiner/roboot"
+)
+
+type AccessLogFormat uint8
+
+const (
+	AccessLogCombined AccessLogFormat = iota // Apache combined log format
+	AccessLogJSON                            // one JSON object per line
+	AccessLogSlog                            // log/slog attributes
+)
+
+type AccessLogEntry struct {
+	Time      time.Time     `json:"time"`
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`
+	Proto     string        `json:"proto"`
+	Pattern   string        `json:"pattern,omitempty"`
+	Status    int           `json:"status"`
+	Bytes     int64         `json:"bytes"`
+	Latency   time.Duration `json:"latency"`
+	ClientIP  string        `json:"client_ip"`
+	UserAgent string        `json:"user_agent,omitempty"`
+	Referer   string        `json:"referer,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+type AccessLog struct {
+	Format AccessLogFormat
+	Writer io.Writer // for Combined and JSON format, default os.Stdout
+
+	Logger *slog.Logger // for Slog format, default slog.Default()
+	Level  slog.Level
+}
+
+type accessLogFilter struct {
+	format AccessLogFormat
+	level  slog.Level
+	logger *slog.Logger
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (a *AccessLog) ToFilter() roboot.Filter {
+	f := accessLogFilter{
+		format: a.Format,
+		w:      a.Writer,
+		logger: a.Logger,
+		level:  a.Level,
+	}
+	if f.w == nil {
+		f.w = os.Stdout
+	}
+	if f.logger == nil {
+		f.logger = slog.Default()
+	}
+	return &f
+}
+
+func (f *accessLogFilter) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	var (
+		resp  = ctx.Resp
+		begin = time.Now()
+	)
+	chain.Handle(ctx)
+
+	entry := AccessLogEntry{
+		Time:      begin,
+		Method:    ctx.Req.Method,
+		Path:      ctx.Req.URL.Path,
+		Proto:     ctx.Req.Proto,
+		Pattern:   ctx.RoutePattern(),
+		Status:    resp.StatusCode(),
+		Bytes:     resp.BytesWritten(),
+		Latency:   time.Since(begin),
+		ClientIP:  ctx.ClientIP(),
+		UserAgent: ctx.Req.UserAgent(),
+		Referer:   ctx.Req.Referer(),
+		RequestID: ctx.RequestID(),
+	}
+	switch f.format {
+	case AccessLogJSON:
+		b, err := json.Marshal(&entry)
+		if err == nil {
+			f.write(append(b, '\n'))
+		}
+	case AccessLogSlog:
+		f.logger.LogAttrs(ctx.Req.Context(), f.level, "access",
+			slog.String("method", entry.Method),
+			slog.String("path", entry.Path),
+			slog.String("proto", entry.Proto),
+			slog.String("pattern", entry.Pattern),
+			slog.Int("status", entry.Status),
+			slog.Int64("bytes", entry.Bytes),
+			slog.Duration("latency", entry.Latency),
+			slog.String("client_ip", entry.ClientIP),
+			slog.String("user_agent", entry.UserAgent),
+			slog.String("referer", entry.Referer),
+			slog.String("request_id", entry.RequestID),
+		)
+	default:
+		f.write(combinedLog(ctx, &entry))
+	}
+}
+
+func (f *accessLogFilter) write(b []byte) {
+	f.mu.Lock()
+	f.w.Write(b)
+	f.mu.Unlock()
+}
+
+func combinedLogField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func combinedLog(ctx *roboot.Context, entry *AccessLogEntry) []byte {
+	user := "-"
+	if ctx.Req.URL.User != nil {
+		user = combinedLogField(ctx.Req.URL.User.Username())
+	} else if name, _, ok := ctx.Req.BasicAuth(); ok {
+		user = combinedLogField(name)
+	}
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = strconv.FormatInt(entry.Bytes, 10)
+	}
+
+	var buf strings.Builder
+	buf.WriteString(combinedLogField(entry.ClientIP))
+	buf.WriteString(" - ")
+	buf.WriteString(user)
+	buf.WriteString(" [")
+	buf.WriteString(entry.Time.Format("02/Jan/2006:15:04:05 -0700"))
+	buf.WriteString("] ")
+	buf.WriteString(strconv.Quote(entry.Method + " " + ctx.Req.URL.RequestURI() + " " + entry.Proto))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.Itoa(entry.Status))
+	buf.WriteByte(' ')
+	buf.WriteString(bytes)
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.Quote(combinedLogField(entry.Referer)))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.Quote(combinedLogField(entry.UserAgent)))
+	buf.WriteByte('\n')
+	return []byte(buf.String())
+}
@@ -0,0 +1,70 @@
+package filters_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func accessLogRequest(t *testing.T, filter roboot.Filter) {
+	s := newServer(t, "/users/:id", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		ctx.Status(http.StatusCreated)
+		ctx.Resp.Write([]byte("hello"))
+	}), filter)
+	req, _ := http.NewRequest("GET", "/users/1?x=1", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("User-Agent", "test-agent")
+	serve(s, req)
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	var buf bytes.Buffer
+	accessLogRequest(t, (&filters.AccessLog{Writer: &buf}).ToFilter())
+
+	expect := regexp.MustCompile(`^10\.0\.0\.1 - - \[[^]]+\] "GET /users/1\?x=1 HTTP/1\.1" 201 5 "-" "test-agent"\n$`)
+	if !expect.MatchString(buf.String()) {
+		t.Errorf("unexpected combined log: %s", buf.String())
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	var buf bytes.Buffer
+	accessLogRequest(t, (&filters.AccessLog{Format: filters.AccessLogJSON, Writer: &buf}).ToFilter())
+
+	var entry filters.AccessLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Method != "GET" || entry.Path != "/users/1" || entry.Pattern != "/users/:id" ||
+		entry.Status != http.StatusCreated || entry.Bytes != 5 || entry.ClientIP != "10.0.0.1" || entry.UserAgent != "test-agent" {
+		t.Errorf("unexpected json log: %s", buf.String())
+	}
+}
+
+func TestAccessLogSlog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	accessLogRequest(t, (&filters.AccessLog{Format: filters.AccessLogSlog, Logger: logger, Level: slog.LevelWarn}).ToFilter())
+
+	var record struct {
+		Level    string
+		Msg      string
+		Pattern  string
+		Status   int
+		Bytes    int64
+		ClientIP string `json:"client_ip"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Level != "WARN" || record.Msg != "access" || record.Pattern != "/users/:id" ||
+		record.Status != http.StatusCreated || record.Bytes != 5 || record.ClientIP != "10.0.0.1" {
+		t.Errorf("unexpected slog record: %s", buf.String())
+	}
+}
@@ -0,0 +1,291 @@
+package filters
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cosiner/roboot"
+)
+
+type CircuitState uint8
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "Closed"
+	case CircuitOpen:
+		return "Open"
+	case CircuitHalfOpen:
+		return "HalfOpen"
+	default:
+		return "Unknown"
+	}
+}
+
+type CircuitBreakerConfig struct {
+	Name string // label value of metrics
+
+	// the circuit opens if consecutive failures reach FailureThreshold, or failure ratio
+	// reach FailureRatio when there are at least MinRequests requests in current Window.
+	FailureThreshold int           // default 5
+	FailureRatio     float64       // zero means disabled
+	MinRequests      int           // default 20
+	Window           time.Duration // default 10s
+
+	OpenTimeout    time.Duration // duration before half-open, default 30s
+	HalfOpenProbes int           // max concurrent probes, and successes required to close, default 1
+
+	IsFailure     func(ctx *roboot.Context) bool // default status >= 500 or unresponded errors, client errors are not failures
+	Fallback      roboot.Handler                 // serve requests while open, default 503 through Env.Error
+	OnStateChange func(name string, from, to CircuitState)
+}
+
+type CircuitBreaker struct {
+	name             string
+	failureThreshold int
+	failureRatio     float64
+	minRequests      int
+	window           time.Duration
+	openTimeout      time.Duration
+	halfOpenProbes   int
+	isFailure        func(ctx *roboot.Context) bool
+	fallback         roboot.Handler
+	onStateChange    func(name string, from, to CircuitState)
+
+	mu          sync.Mutex
+	state       CircuitState
+	generation  uint64
+	windowStart time.Time
+	openedAt    time.Time
+	requests    int
+	failures    int
+	consecutive int
+	probes      int
+	successes   int
+
+	totalFailures uint64
+	totalRejected uint64
+
+	transitions [][2]CircuitState // state changes to be notified after unlock
+}
+
+var _ roboot.Filter = &CircuitBreaker{}
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+func isFailureResponse(ctx *roboot.Context) bool {
+	if ctx.Resp.StatusCode() >= http.StatusInternalServerError {
+		return true
+	}
+	// errors the error handler didn't respond, the implicit 200 is not a success
+	if ctx.LastError() == nil {
+		return false
+	}
+	if w, ok := ctx.Resp.(interface{ HeaderWritten() bool }); ok {
+		return !w.HeaderWritten()
+	}
+	return ctx.Resp.BytesWritten() == 0
+}
+
+func NewCircuitBreaker(c CircuitBreakerConfig) *CircuitBreaker {
+	const (
+		defaultFailureThreshold = 5
+		defaultMinRequests      = 20
+		defaultWindow           = 10 * time.Second
+		defaultOpenTimeout      = 30 * time.Second
+		defaultHalfOpenProbes   = 1
+	)
+	b := &CircuitBreaker{
+		name:             c.Name,
+		failureThreshold: c.FailureThreshold,
+		failureRatio:     c.FailureRatio,
+		minRequests:      c.MinRequests,
+		window:           c.Window,
+		openTimeout:      c.OpenTimeout,
+		halfOpenProbes:   c.HalfOpenProbes,
+		isFailure:        c.IsFailure,
+		fallback:         c.Fallback,
+		onStateChange:    c.OnStateChange,
+	}
+	if b.failureThreshold <= 0 {
+		b.failureThreshold = defaultFailureThreshold
+	}
+	if b.minRequests <= 0 {
+		b.minRequests = defaultMinRequests
+	}
+	if b.window <= 0 {
+		b.window = defaultWindow
+	}
+	if b.openTimeout <= 0 {
+		b.openTimeout = defaultOpenTimeout
+	}
+	if b.halfOpenProbes <= 0 {
+		b.halfOpenProbes = defaultHalfOpenProbes
+	}
+	if b.isFailure == nil {
+		b.isFailure = isFailureResponse
+	}
+	if b.fallback == nil {
+		b.fallback = roboot.HandlerFunc(func(ctx *roboot.Context) {
+			ctx.Error(ErrCircuitOpen, http.StatusServiceUnavailable)
+		})
+	}
+	return b
+}
+
+func (b *CircuitBreaker) setState(state CircuitState, now time.Time) {
+	if b.state == state {
+		return
+	}
+	prev := b.state
+	b.state = state
+	b.generation++
+	b.windowStart = now
+	b.requests, b.failures, b.consecutive = 0, 0, 0
+	b.probes, b.successes = 0, 0
+	if state == CircuitOpen {
+		b.openedAt = now
+	}
+	if b.onStateChange != nil {
+		b.transitions = append(b.transitions, [2]CircuitState{prev, state})
+	}
+}
+
+func (b *CircuitBreaker) unlock() {
+	transitions := b.transitions
+	b.transitions = nil
+	b.mu.Unlock()
+	for _, t := range transitions {
+		b.onStateChange(b.name, t[0], t[1])
+	}
+}
+
+// refresh update the state by time, must be called with lock held.
+func (b *CircuitBreaker) refresh(now time.Time) {
+	switch b.state {
+	case CircuitOpen:
+		if now.Sub(b.openedAt) >= b.openTimeout {
+			b.setState(CircuitHalfOpen, now)
+		}
+	case CircuitClosed:
+		if now.Sub(b.windowStart) >= b.window {
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+	}
+}
+
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.unlock()
+	b.refresh(time.Now())
+	return b.state
+}
+
+func (b *CircuitBreaker) before() (uint64, bool) {
+	b.mu.Lock()
+	defer b.unlock()
+	b.refresh(time.Now())
+	switch b.state {
+	case CircuitOpen:
+		b.totalRejected++
+		return 0, false
+	case CircuitHalfOpen:
+		if b.probes >= b.halfOpenProbes {
+			b.totalRejected++
+			return 0, false
+		}
+		b.probes++
+	}
+	return b.generation, true
+}
+
+func (b *CircuitBreaker) after(generation uint64, failed bool) {
+	b.mu.Lock()
+	defer b.unlock()
+	now := time.Now()
+	if failed {
+		b.totalFailures++
+	}
+	b.refresh(now)
+	if generation != b.generation { // started in previous state
+		return
+	}
+
+	switch b.state {
+	case CircuitClosed:
+		b.requests++
+		if !failed {
+			b.consecutive = 0
+			return
+		}
+		b.failures++
+		b.consecutive++
+		if b.consecutive >= b.failureThreshold ||
+			(b.failureRatio > 0 && b.requests >= b.minRequests && float64(b.failures)/float64(b.requests) >= b.failureRatio) {
+			b.setState(CircuitOpen, now)
+		}
+	case CircuitHalfOpen:
+		if failed {
+			b.setState(CircuitOpen, now)
+			return
+		}
+		b.probes--
+		b.successes++
+		if b.successes >= b.halfOpenProbes {
+			b.setState(CircuitClosed, now)
+		}
+	}
+}
+
+func (b *CircuitBreaker) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	generation, ok := b.before()
+	if !ok {
+		b.fallback.Handle(ctx)
+		return
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			b.after(generation, true)
+			panic(err)
+		}
+	}()
+	chain.Handle(ctx)
+	b.after(generation, b.isFailure(ctx))
+}
+
+func (b *CircuitBreaker) CollectMetrics() []MetricFamily {
+	b.mu.Lock()
+	defer b.unlock()
+	b.refresh(time.Now())
+	labels := []string{"breaker", b.name}
+	return []MetricFamily{
+		{
+			Name:    "circuit_breaker_state",
+			Help:    "Circuit breaker state, 0: closed, 1: open, 2: half-open.",
+			Type:    MetricGauge,
+			Samples: []MetricSample{{Labels: labels, Value: float64(b.state)}},
+		},
+		{
+			Name:    "circuit_breaker_failures_total",
+			Help:    "Total number of failed requests.",
+			Type:    MetricCounter,
+			Samples: []MetricSample{{Labels: labels, Value: float64(b.totalFailures)}},
+		},
+		{
+			Name:    "circuit_breaker_rejected_total",
+			Help:    "Total number of requests served by fallback.",
+			Type:    MetricCounter,
+			Samples: []MetricSample{{Labels: labels, Value: float64(b.totalRejected)}},
+		},
+	}
+}
@@ -0,0 +1,114 @@
+package filters_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/codec"
+	"github.com/cosiner/roboot/filters"
+	"github.com/cosiner/roboot/router"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var transitions []string
+	breaker := filters.NewCircuitBreaker(filters.CircuitBreakerConfig{
+		Name:             "api",
+		FailureThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+		Fallback: roboot.HandlerFunc(func(ctx *roboot.Context) {
+			ctx.Status(http.StatusTeapot)
+		}),
+		OnStateChange: func(name string, from, to filters.CircuitState) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+	status := http.StatusOK
+	s := newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		if status >= http.StatusBadRequest {
+			ctx.Error(errors.New("failed"), status)
+		} else {
+			ctx.Status(status)
+		}
+	}), breaker)
+	request := func(expect int) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "/", nil)
+		if resp := serve(s, req); resp.Code != expect {
+			t.Fatalf("expect status %d, got %d", expect, resp.Code)
+		}
+	}
+
+	status = http.StatusBadRequest
+	request(http.StatusBadRequest)
+	request(http.StatusBadRequest)
+	if state := breaker.State(); state != filters.CircuitClosed {
+		t.Fatalf("client errors should not open the circuit, got %s", state)
+	}
+
+	status = http.StatusInternalServerError
+	request(http.StatusInternalServerError)
+	request(http.StatusInternalServerError)
+	if state := breaker.State(); state != filters.CircuitOpen {
+		t.Fatalf("expect open, got %s", state)
+	}
+	request(http.StatusTeapot)
+
+	time.Sleep(60 * time.Millisecond)
+	if state := breaker.State(); state != filters.CircuitHalfOpen {
+		t.Fatalf("expect half-open, got %s", state)
+	}
+	request(http.StatusInternalServerError)
+	if state := breaker.State(); state != filters.CircuitOpen {
+		t.Fatalf("failed probe should reopen, got %s", state)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	status = http.StatusOK
+	request(http.StatusOK)
+	if state := breaker.State(); state != filters.CircuitClosed {
+		t.Fatalf("successful probe should close, got %s", state)
+	}
+	expect := "Closed->Open,Open->HalfOpen,HalfOpen->Open,Open->HalfOpen,HalfOpen->Closed"
+	if got := strings.Join(transitions, ","); got != expect {
+		t.Errorf("expect transitions %s, got %s", expect, got)
+	}
+
+	var buf bytes.Buffer
+	filters.WriteMetrics(&buf, breaker.CollectMetrics())
+	for _, line := range []string{
+		`circuit_breaker_state{breaker="api"} 0`,
+		`circuit_breaker_failures_total{breaker="api"} 3`,
+		`circuit_breaker_rejected_total{breaker="api"} 1`,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("metrics should contain %s:\n%s", line, buf.String())
+		}
+	}
+}
+
+type silentErrorHandler struct{}
+
+func (silentErrorHandler) Log(ctx *roboot.Context, errType roboot.ErrType, err error) {}
+
+func (silentErrorHandler) Handle(ctx *roboot.Context, callerDepth int, status int, err error) {}
+
+func TestCircuitBreakerUnrespondedError(t *testing.T) {
+	breaker := filters.NewCircuitBreaker(filters.CircuitBreakerConfig{FailureThreshold: 1})
+	s := roboot.NewServer(roboot.Env{Codec: codec.JSON, Error: silentErrorHandler{}}, router.New())
+	err := s.Router("").Handle("/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		ctx.Error(errors.New("failed"), http.StatusInternalServerError)
+	}), breaker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/", nil)
+	serve(s, req)
+	if state := breaker.State(); state != filters.CircuitOpen {
+		t.Fatalf("unresponded handler error should be failure, got %s", state)
+	}
+}
@@ -0,0 +1,536 @@
+package filters
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cosiner/roboot"
+)
+
+// ParseCacheControl parse Cache-Control directives, directive names are lower cased.
+func ParseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, item := range strings.Split(header, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var value string
+		if index := strings.IndexByte(item, '='); index >= 0 {
+			item, value = item[:index], strings.Trim(item[index+1:], `"`)
+		}
+		directives[strings.ToLower(strings.TrimSpace(item))] = value
+	}
+	return directives
+}
+
+func cacheControlSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	value, has := directives[name]
+	if !has {
+		return 0, false
+	}
+	secs, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+type cacheEntry struct {
+	key        string
+	base       string
+	status     int
+	header     http.Header
+	body       []byte
+	storedAt   time.Time
+	expires    time.Time
+	staleUntil time.Time
+	size       int64
+	elem       *list.Element
+}
+
+// cacheRecorder record the response, and pass through to the underlying writer if
+// it's not nil. It use it's own header map to tell headers set by downstream from
+// per-request headers set by upstream such as request id.
+type cacheRecorder struct {
+	w        roboot.ResponseWriter
+	base     http.Header // headers of w when the recorder is created
+	header   http.Header
+	synced   bool
+	code     int
+	buf      bytes.Buffer
+	maxSize  int
+	tooLarge bool
+}
+
+var _ roboot.ResponseWriter = &cacheRecorder{}
+
+func newCacheRecorder(w roboot.ResponseWriter, maxSize int) *cacheRecorder {
+	r := cacheRecorder{
+		w:       w,
+		maxSize: maxSize,
+	}
+	if w != nil {
+		r.base = w.Header().Clone()
+		r.header = w.Header().Clone()
+	} else {
+		r.header = make(http.Header)
+	}
+	return &r
+}
+
+func (r *cacheRecorder) Header() http.Header {
+	return r.header
+}
+
+// syncHeader replace headers of the underlying writer with the recorder's.
+func (r *cacheRecorder) syncHeader() {
+	if r.w == nil || r.synced {
+		return
+	}
+	r.synced = true
+	header := r.w.Header()
+	for k := range header {
+		if _, has := r.header[k]; !has {
+			delete(header, k)
+		}
+	}
+	for k, v := range r.header {
+		header[k] = v
+	}
+}
+
+// recordedHeader return headers set or changed after the recorder is created.
+func (r *cacheRecorder) recordedHeader() http.Header {
+	header := make(http.Header)
+	for k, v := range r.header {
+		if !equalStrings(r.base[k], v) {
+			header[k] = append([]string(nil), v...)
+		}
+	}
+	return header
+}
+
+func (r *cacheRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	if r.w != nil {
+		r.syncHeader()
+		r.w.WriteHeader(code)
+	}
+}
+
+func (r *cacheRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	r.syncHeader()
+	if !r.tooLarge {
+		if r.buf.Len()+len(b) > r.maxSize {
+			r.tooLarge = true
+			r.buf = bytes.Buffer{}
+		} else {
+			r.buf.Write(b)
+		}
+	}
+	if r.w != nil {
+		return r.w.Write(b)
+	}
+	return len(b), nil
+}
+
+func (r *cacheRecorder) StatusCode() int {
+	if r.w != nil {
+		return r.w.StatusCode()
+	}
+	if r.code == 0 {
+		return http.StatusOK
+	}
+	return r.code
+}
+
+func (r *cacheRecorder) BytesWritten() int64 {
+	if r.w != nil {
+		return r.w.BytesWritten()
+	}
+	return int64(r.buf.Len())
+}
+
+type ResponseCacheConfig struct {
+	TTL                  time.Duration // freshness if handler didn't set max-age, default 1m
+	StaleWhileRevalidate time.Duration // used if handler didn't set stale-while-revalidate
+	MaxBytes             int64         // memory bound of all entries, default 64M
+	MaxEntrySize         int           // responses larger than it are not cached, default 1M
+	// query params included in cache key, nil means all query params
+	QueryParams []string
+}
+
+type cacheCall struct {
+	done chan struct{}
+}
+
+type cacheVary struct {
+	headers []string
+	entries int
+}
+
+// ResponseCache cache responses of GET and HEAD requests in memory, entries are evicted
+// in LRU order when exceeds the memory bound. Concurrent misses of the same key are
+// coalesced so that only one reaches the handler. Responses of requests with CSP nonce
+// are not stored.
+type ResponseCache struct {
+	ttl          time.Duration
+	swr          time.Duration
+	maxBytes     int64
+	maxEntrySize int
+	queryParams  []string
+
+	mu       sync.Mutex
+	size     int64
+	lru      list.List
+	entries  map[string]*cacheEntry
+	varies   map[string]*cacheVary // base key to vary headers
+	inflight map[string]*cacheCall
+}
+
+var _ roboot.Filter = &ResponseCache{}
+
+func NewResponseCache(c ResponseCacheConfig) *ResponseCache {
+	const (
+		defaultTTL          = time.Minute
+		defaultMaxBytes     = 64 << 20
+		defaultMaxEntrySize = 1 << 20
+	)
+	rc := &ResponseCache{
+		ttl:          c.TTL,
+		swr:          c.StaleWhileRevalidate,
+		maxBytes:     c.MaxBytes,
+		maxEntrySize: c.MaxEntrySize,
+		entries:      make(map[string]*cacheEntry),
+		varies:       make(map[string]*cacheVary),
+		inflight:     make(map[string]*cacheCall),
+	}
+	if c.QueryParams != nil {
+		rc.queryParams = append([]string{}, c.QueryParams...)
+		sort.Strings(rc.queryParams)
+	}
+	if rc.ttl <= 0 {
+		rc.ttl = defaultTTL
+	}
+	if rc.maxBytes <= 0 {
+		rc.maxBytes = defaultMaxBytes
+	}
+	if rc.maxEntrySize <= 0 {
+		rc.maxEntrySize = defaultMaxEntrySize
+	}
+	return rc
+}
+
+func (c *ResponseCache) baseKey(ctx *roboot.Context) string {
+	var query string
+	if c.queryParams == nil {
+		query = ctx.Req.URL.Query().Encode()
+	} else {
+		values := ctx.Req.URL.Query()
+		selected := make(url.Values, len(c.queryParams))
+		for _, name := range c.queryParams {
+			if v, has := values[name]; has {
+				selected[name] = v
+			}
+		}
+		query = selected.Encode()
+	}
+	return ctx.Req.Method + " " + ctx.Req.URL.Path + "?" + query
+}
+
+func varyKey(base string, vary []string, header http.Header) string {
+	if len(vary) == 0 {
+		return base
+	}
+	var buf strings.Builder
+	buf.WriteString(base)
+	for _, name := range vary {
+		buf.WriteString("\n" + name + ":" + strings.Join(header[name], ","))
+	}
+	return buf.String()
+}
+
+func (c *ResponseCache) lookup(ctx *roboot.Context, base string) *cacheEntry {
+	vary := c.varies[base]
+	if vary == nil {
+		return nil
+	}
+	entry := c.entries[varyKey(base, vary.headers, ctx.Req.Header)]
+	if entry != nil {
+		c.lru.MoveToFront(entry.elem)
+	}
+	return entry
+}
+
+func (c *ResponseCache) remove(entry *cacheEntry) {
+	delete(c.entries, entry.key)
+	c.lru.Remove(entry.elem)
+	c.size -= entry.size
+	if vary := c.varies[entry.base]; vary != nil {
+		vary.entries--
+		if vary.entries <= 0 {
+			delete(c.varies, entry.base)
+		}
+	}
+}
+
+// Purge remove all entries.
+func (c *ResponseCache) Purge() {
+	c.mu.Lock()
+	c.entries = make(map[string]*cacheEntry)
+	c.varies = make(map[string]*cacheVary)
+	c.lru.Init()
+	c.size = 0
+	c.mu.Unlock()
+}
+
+func isCacheableStatus(status int) bool {
+	switch status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+		return true
+	}
+	return false
+}
+
+// store add the recorded response to cache if it's cacheable.
+func (c *ResponseCache) store(ctx *roboot.Context, base string, r *cacheRecorder) {
+	status := r.code
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := r.Header()
+	if r.tooLarge || !isCacheableStatus(status) || header.Get(roboot.HeaderSetCookie) != "" {
+		return
+	}
+	// the body may embed the CSP nonce, which is not valid for other requests
+	if CSPNonce(ctx) != "" {
+		return
+	}
+	directives := ParseCacheControl(header.Get(roboot.HeaderCacheControl))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, has := directives[d]; has {
+			return
+		}
+	}
+	var vary []string
+	for _, value := range header[roboot.HeaderVary] {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return
+			}
+			if name != "" {
+				vary = append(vary, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(vary)
+
+	ttl, has := cacheControlSeconds(directives, "s-maxage")
+	if !has {
+		ttl, has = cacheControlSeconds(directives, "max-age")
+	}
+	if !has {
+		ttl = c.ttl
+	}
+	if ttl <= 0 {
+		return
+	}
+	swr, has := cacheControlSeconds(directives, "stale-while-revalidate")
+	if !has {
+		swr = c.swr
+	}
+
+	now := time.Now()
+	entry := &cacheEntry{
+		key:        varyKey(base, vary, ctx.Req.Header),
+		base:       base,
+		status:     status,
+		header:     r.recordedHeader(),
+		body:       append([]byte(nil), r.buf.Bytes()...),
+		storedAt:   now,
+		expires:    now.Add(ttl),
+		staleUntil: now.Add(ttl + swr),
+	}
+	entry.header.Del(roboot.HeaderAge)
+	entry.size = int64(len(entry.key) + len(entry.body))
+	for k, v := range entry.header {
+		entry.size += int64(len(k))
+		for _, s := range v {
+			entry.size += int64(len(s))
+		}
+	}
+	if entry.size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old := c.entries[entry.key]; old != nil {
+		c.remove(old)
+	}
+	v := c.varies[base]
+	if v != nil && !equalStrings(v.headers, vary) {
+		// vary headers changed, entries of previous variants are unreachable
+		for _, e := range c.entries {
+			if e.base == base {
+				c.remove(e)
+			}
+		}
+		v = nil
+	}
+	if v == nil {
+		v = &cacheVary{headers: vary}
+		c.varies[base] = v
+	}
+	v.entries++
+	entry.elem = c.lru.PushFront(entry)
+	c.entries[entry.key] = entry
+	c.size += entry.size
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back().Value.(*cacheEntry))
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *ResponseCache) serve(ctx *roboot.Context, entry *cacheEntry, now time.Time) {
+	header := ctx.Resp.Header()
+	for k, v := range entry.header {
+		header[k] = append([]string(nil), v...)
+	}
+	header.Set(roboot.HeaderAge, strconv.Itoa(int(now.Sub(entry.storedAt)/time.Second)))
+	ctx.Status(entry.status)
+	if ctx.Req.Method != roboot.MethodHead {
+		ctx.Resp.Write(entry.body)
+	}
+}
+
+func (c *ResponseCache) revalidate(ctx *roboot.Context, chain roboot.Handler, base string) {
+	c.mu.Lock()
+	if _, has := c.inflight[base]; has {
+		c.mu.Unlock()
+		return
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	c.inflight[base] = call
+	c.mu.Unlock()
+
+	hctx := ctx.Clone()
+	hctx.Req = ctx.Req.WithContext(context.Background())
+	r := newCacheRecorder(nil, c.maxEntrySize)
+	hctx.Resp = r
+	go func() {
+		defer c.finishCall(base, call)
+		defer func() {
+			if err := recover(); err != nil {
+				hctx.Env().Error.Log(hctx, roboot.ErrTypePanic, fmt.Errorf("cache revalidate panic: %v", err))
+			}
+		}()
+		chain.Handle(hctx)
+		c.store(hctx, base, r)
+	}()
+}
+
+func (c *ResponseCache) finishCall(base string, call *cacheCall) {
+	c.mu.Lock()
+	delete(c.inflight, base)
+	c.mu.Unlock()
+	close(call.done)
+}
+
+func (c *ResponseCache) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	if ctx.Req.Method != roboot.MethodGet && ctx.Req.Method != roboot.MethodHead ||
+		ctx.Req.Header.Get(roboot.HeaderAuthorization) != "" {
+		chain.Handle(ctx)
+		return
+	}
+	directives := ParseCacheControl(ctx.Req.Header.Get(roboot.HeaderCacheControl))
+	if _, has := directives["no-store"]; has {
+		chain.Handle(ctx)
+		return
+	}
+	_, noCache := directives["no-cache"]
+	maxAge, hasMaxAge := cacheControlSeconds(directives, "max-age")
+
+	var (
+		base = c.baseKey(ctx)
+		call *cacheCall
+	)
+	for call == nil {
+		now := time.Now()
+		c.mu.Lock()
+		entry := c.lookup(ctx, base)
+		if entry != nil && !noCache && (!hasMaxAge || now.Sub(entry.storedAt) <= maxAge) {
+			if now.Before(entry.expires) {
+				c.mu.Unlock()
+				c.serve(ctx, entry, now)
+				return
+			}
+			if now.Before(entry.staleUntil) {
+				c.mu.Unlock()
+				c.serve(ctx, entry, now)
+				c.revalidate(ctx, chain, base)
+				return
+			}
+		}
+
+		leader, has := c.inflight[base]
+		if !has {
+			call = &cacheCall{done: make(chan struct{})}
+			c.inflight[base] = call
+			c.mu.Unlock()
+			break
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-leader.done:
+			noCache = false // the response just stored is fresh enough
+		case <-ctx.Req.Context().Done():
+			return
+		}
+		c.mu.Lock()
+		entry = c.lookup(ctx, base)
+		c.mu.Unlock()
+		if entry == nil {
+			chain.Handle(ctx) // response of the leader is not cacheable
+			return
+		}
+	}
+
+	defer c.finishCall(base, call)
+	r := newCacheRecorder(ctx.Resp, c.maxEntrySize)
+	resp := ctx.Resp
+	ctx.Resp = r
+	chain.Handle(ctx)
+	ctx.Resp = resp
+	r.syncHeader()
+	c.store(ctx, base, r)
+}
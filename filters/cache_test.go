@@ -0,0 +1,97 @@
+package filters_test
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func TestResponseCache(t *testing.T) {
+	var calls int32
+	cache := filters.NewResponseCache(filters.ResponseCacheConfig{TTL: time.Minute})
+	s := newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		n := atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		ctx.Resp.Header().Set(roboot.HeaderVary, "Accept-Language")
+		ctx.Resp.Write([]byte(ctx.Req.Header.Get("Accept-Language") + strconv.Itoa(int(n))))
+	}), cache)
+
+	get := func(lang string) string {
+		req, _ := http.NewRequest("GET", "/?a=1", nil)
+		req.Header.Set("Accept-Language", lang)
+		return serve(s, req).Body.String()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if body := get("en"); body != "en1" {
+				t.Errorf("concurrent misses should be coalesced, got %s", body)
+			}
+		}()
+	}
+	wg.Wait()
+	if body := get("fr"); body != "fr2" {
+		t.Fatalf("expect response varied by language, got %s", body)
+	}
+	if body := get("en"); body != "en1" {
+		t.Fatalf("expect cached response, got %s", body)
+	}
+
+	req, _ := http.NewRequest("GET", "/?a=1", nil)
+	req.Header.Set("Accept-Language", "en")
+	req.Header.Set(roboot.HeaderCacheControl, "no-cache")
+	if body := serve(s, req).Body.String(); body != "en3" {
+		t.Fatalf("no-cache request should reach handler, got %s", body)
+	}
+}
+
+func TestResponseCacheRequestHeaders(t *testing.T) {
+	cache := filters.NewResponseCache(filters.ResponseCacheConfig{TTL: time.Minute})
+	s := newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		ctx.Resp.Header().Set("X-Handler", "cached")
+		ctx.Resp.Write([]byte("body"))
+	}), (&filters.RequestID{}).ToFilter(), cache)
+
+	ids := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		resp := serve(s, req)
+		if resp.Body.String() != "body" || resp.Header().Get("X-Handler") != "cached" {
+			t.Fatalf("unexpected response: %s %v", resp.Body.String(), resp.Header())
+		}
+		ids[resp.Header().Get(roboot.HeaderXRequestID)] = true
+	}
+	if len(ids) != 2 {
+		t.Errorf("request id should not be cached: %v", ids)
+	}
+}
+
+func TestResponseCacheCSPNonce(t *testing.T) {
+	var count int
+	cache := filters.NewResponseCache(filters.ResponseCacheConfig{TTL: time.Minute})
+	secure := filters.Secure{ContentSecurityPolicy: "script-src 'nonce-{nonce}'"}
+	s := newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		count++
+		ctx.Resp.Write([]byte(filters.CSPNonce(ctx)))
+	}), secure.ToFilter(), cache)
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		resp := serve(s, req)
+		if csp := resp.Header().Get(roboot.HeaderContentSecurityPolicy); csp != "script-src 'nonce-"+resp.Body.String()+"'" {
+			t.Errorf("%d: nonce of body %s mismatch policy %s", i, resp.Body.String(), csp)
+		}
+	}
+	if count != 2 {
+		t.Errorf("responses with nonce should not be cached, handled %d", count)
+	}
+}
@@ -2,24 +2,109 @@ package filters
 
 import (
 	"bufio"
+	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"io"
+	"mime"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/cosiner/roboot"
 )
 
+type compressor interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
 type compressWriter struct {
-	hijacked bool
-	cw       io.WriteCloser
 	roboot.ResponseWriter
+	filter *compressFilter
+
+	encoding string
+	code     int
+	buf      bytes.Buffer
+	decided  bool
+	cw       compressor
+	hijacked bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+	} else if w.code == 0 {
+		w.code = code
+	}
 }
 
 func (w *compressWriter) Write(data []byte) (int, error) {
-	return w.cw.Write(data)
+	if !w.decided {
+		if w.code == 0 {
+			w.code = http.StatusOK
+		}
+		if w.buf.Len()+len(data) < w.filter.minSize {
+			return w.buf.Write(data)
+		}
+		w.buf.Write(data)
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.cw != nil {
+		return w.cw.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// decide choose whether to compress the response by status, headers and buffered
+// content, then write the header and flush the buffer.
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	header := w.ResponseWriter.Header()
+	if large && w.code != http.StatusNoContent && w.code != http.StatusNotModified && w.code >= http.StatusOK &&
+		header.Get(roboot.HeaderContentEncoding) == "" {
+		contentType := header.Get(roboot.HeaderContentType)
+		if contentType == "" {
+			contentType = http.DetectContentType(w.buf.Bytes())
+			header.Set(roboot.HeaderContentType, contentType)
+		}
+		if w.filter.allowContentType(contentType) {
+			header.Set(roboot.HeaderContentEncoding, w.encoding)
+			header.Del(roboot.HeaderContentLength)
+			w.cw = w.filter.getCompressor(w.encoding, w.ResponseWriter)
+		}
+	}
+	if w.code != 0 {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.cw != nil {
+		_, err = w.cw.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+func (w *compressWriter) StatusCode() int {
+	if !w.decided && w.code != 0 {
+		return w.code
+	}
+	return w.ResponseWriter.StatusCode()
+}
+
+func (w *compressWriter) BytesWritten() int64 {
+	return w.ResponseWriter.BytesWritten() + int64(w.buf.Len())
 }
 
 func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
@@ -35,56 +120,220 @@ func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 }
 
 func (w *compressWriter) Close() error {
-	if !w.hijacked {
-		return w.cw.Close()
+	if w.hijacked {
+		return nil
+	}
+	if !w.decided {
+		if err := w.decide(false); err != nil {
+			return err
+		}
+	}
+	if w.cw == nil {
+		return nil
 	}
+	err := w.cw.Close()
+	w.filter.putCompressor(w.encoding, w.cw)
+	w.cw = nil
+	return err
+}
 
-	return nil
+// Compression compress responses with the encoding negotiated from Accept-Encoding,
+// responses smaller than MinSize, already encoded or of content types not allowed
+// are sent as is.
+type Compression struct {
+	Encodings    []string // supported encodings in preference order, default gzip and deflate
+	Level        int      // compression level of compress/flate, 0 means flate.DefaultCompression
+	MinSize      int      // default 1024
+	ContentTypes []string // allowed content types, "type/*" matches all subtypes, default text and common api types
 }
 
-func gzipCompress(w roboot.ResponseWriter) (roboot.ResponseWriter, bool) {
-	w.Header().Set(roboot.HeaderContentEncoding, roboot.ContentEncodingGzip)
-	return &compressWriter{
-		cw:             gzip.NewWriter(w),
-		ResponseWriter: w,
-	}, true
+type compressFilter struct {
+	encodings    []string
+	level        int
+	minSize      int
+	contentTypes []string
+
+	gzipPool sync.Pool
+	zlibPool sync.Pool // deflate encoding is zlib wrapped stream by RFC 9110
 }
 
-func flateCompress(w roboot.ResponseWriter) (roboot.ResponseWriter, bool) {
-	fw, err := flate.NewWriter(w, flate.DefaultCompression)
-	if err != nil {
-		return w, false
+var defaultCompressContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/x-javascript",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+func (c *Compression) ToFilter() roboot.Filter {
+	const defaultMinSize = 1024
+	f := compressFilter{
+		level:   c.Level,
+		minSize: c.MinSize,
+	}
+	for _, encoding := range c.Encodings {
+		encoding = strings.ToLower(encoding)
+		if encoding == roboot.ContentEncodingGzip || encoding == roboot.ContentEncodingDeflate {
+			f.encodings = append(f.encodings, encoding)
+		}
+	}
+	if len(f.encodings) == 0 {
+		f.encodings = []string{roboot.ContentEncodingGzip, roboot.ContentEncodingDeflate}
+	}
+	if f.level == 0 || f.level < flate.HuffmanOnly || f.level > flate.BestCompression {
+		f.level = flate.DefaultCompression
 	}
+	if f.minSize <= 0 {
+		f.minSize = defaultMinSize
+	}
+	contentTypes := c.ContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = defaultCompressContentTypes
+	}
+	for _, typ := range contentTypes {
+		f.contentTypes = append(f.contentTypes, strings.ToLower(typ))
+	}
+	f.gzipPool.New = func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, f.level)
+		return w
+	}
+	f.zlibPool.New = func() interface{} {
+		w, _ := zlib.NewWriterLevel(nil, f.level)
+		return w
+	}
+	return &f
+}
 
-	w.Header().Set(roboot.HeaderContentEncoding, roboot.ContentEncodingDeflate)
-	return &compressWriter{
-		cw:             fw,
-		ResponseWriter: w,
-	}, true
+func (f *compressFilter) getCompressor(encoding string, w io.Writer) compressor {
+	var c compressor
+	if encoding == roboot.ContentEncodingGzip {
+		c = f.gzipPool.Get().(*gzip.Writer)
+	} else {
+		c = f.zlibPool.Get().(*zlib.Writer)
+	}
+	c.Reset(w)
+	return c
 }
 
-func Compress(ctx *roboot.Context, chain roboot.Handler) {
-	encoding := ctx.Req.Header.Get(roboot.HeaderAcceptEncoding)
+func (f *compressFilter) putCompressor(encoding string, c compressor) {
+	c.Reset(nil)
+	if encoding == roboot.ContentEncodingGzip {
+		f.gzipPool.Put(c)
+	} else {
+		f.zlibPool.Put(c)
+	}
+}
 
+func (f *compressFilter) allowContentType(contentType string) bool {
+	typ, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allow := range f.contentTypes {
+		if strings.HasSuffix(allow, "/*") {
+			if strings.HasPrefix(typ, allow[:len(allow)-1]) {
+				return true
+			}
+		} else if typ == allow {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate choose the supported encoding with highest q-value, ties are broken by
+// the preference order. Encodings with q=0 are excluded.
+func (f *compressFilter) negotiate(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
 	var (
-		compressed bool
-		oldW       = ctx.Resp
+		qvalues  = make(map[string]float64)
+		wildcard = -1.0
 	)
-	if strings.Contains(encoding, roboot.ContentEncodingGzip) {
-		ctx.Resp, compressed = gzipCompress(oldW)
-	} else if strings.Contains(encoding, roboot.ContentEncodingDeflate) {
-		ctx.Resp, compressed = flateCompress(oldW)
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		var (
+			params = strings.Split(item, ";")
+			coding = strings.ToLower(strings.TrimSpace(params[0]))
+			q      = 1.0
+		)
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if len(param) > 2 && (param[0] == 'q' || param[0] == 'Q') && param[1] == '=' {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+		if coding == "*" {
+			wildcard = q
+		} else if coding != "" {
+			qvalues[coding] = q
+		}
 	}
 
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, encoding := range f.encodings {
+		q, has := qvalues[encoding]
+		if !has {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+func (f *compressFilter) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	addVary(ctx.Resp.Header(), roboot.HeaderAcceptEncoding)
+	encoding := f.negotiate(ctx.Req.Header.Get(roboot.HeaderAcceptEncoding))
+	if encoding == "" || ctx.Req.Method == roboot.MethodHead {
+		chain.Handle(ctx)
+		return
+	}
+
+	var (
+		oldW = ctx.Resp
+		cw   = compressWriter{
+			ResponseWriter: oldW,
+			filter:         f,
+			encoding:       encoding,
+		}
+	)
+	ctx.Resp = &cw
+	defer func() {
+		ctx.Resp = oldW
+	}()
 	chain.Handle(ctx)
-	if compressed {
-		ctx.Resp.Header().Del(roboot.HeaderContentLength)
-		cw, ok := ctx.Resp.(io.Closer)
-		if ok {
-			cw.Close()
+	cw.Close()
+}
+
+// addVary append value to the Vary header if it's not present.
+func addVary(header http.Header, value string) {
+	for _, v := range header[roboot.HeaderVary] {
+		for _, item := range strings.Split(v, ",") {
+			item = strings.TrimSpace(item)
+			if item == "*" || strings.EqualFold(item, value) {
+				return
+			}
 		}
 	}
-	ctx.Resp = oldW
+	header.Add(roboot.HeaderVary, value)
+}
+
+var defaultCompressFilter = (&Compression{}).ToFilter()
+
+// Compress compress responses with default Compression options.
+func Compress(ctx *roboot.Context, chain roboot.Handler) {
+	defaultCompressFilter.Filter(ctx, chain)
 }
 
 var _ roboot.FilterFunc = Compress
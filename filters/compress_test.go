@@ -0,0 +1,73 @@
+package filters_test
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("hello world ", 200)
+	s := newServer(t, "/:size", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		switch ctx.ParamValue("size") {
+		case "small":
+			ctx.Resp.Write([]byte("hello"))
+		case "png":
+			ctx.Resp.Header().Set(roboot.HeaderContentType, "image/png")
+			ctx.Resp.Write([]byte(large))
+		default:
+			ctx.Resp.Header().Set(roboot.HeaderContentType, "text/plain; charset=utf-8")
+			ctx.Resp.Write([]byte(large))
+		}
+	}), (&filters.Compression{MinSize: 100}).ToFilter())
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		encoding       string
+	}{
+		{"/large", "gzip, deflate", "gzip"},
+		{"/large", "gzip;q=0.5, deflate", "deflate"},
+		{"/large", "gzip;q=0, *", "deflate"},
+		{"/large", "gzip;q=0", ""},
+		{"/large", "br", ""},
+		{"/small", "gzip", ""},
+		{"/png", "gzip", ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", test.path, nil)
+		req.Header.Set(roboot.HeaderAcceptEncoding, test.acceptEncoding)
+		resp := serve(s, req)
+		if enc := resp.Header().Get(roboot.HeaderContentEncoding); enc != test.encoding {
+			t.Errorf("%s %s: expect encoding %q, got %q", test.path, test.acceptEncoding, test.encoding, enc)
+		}
+		if resp.Header().Get(roboot.HeaderVary) != roboot.HeaderAcceptEncoding {
+			t.Errorf("%s %s: vary header is not set", test.path, test.acceptEncoding)
+		}
+		if test.encoding != "" {
+			var (
+				r   io.Reader
+				err error
+			)
+			if test.encoding == roboot.ContentEncodingGzip {
+				r, err = gzip.NewReader(resp.Body)
+			} else {
+				r, err = zlib.NewReader(resp.Body)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := ioutil.ReadAll(r)
+			if err != nil || string(body) != large {
+				t.Errorf("%s %s: decompress failed: %v", test.path, test.acceptEncoding, err)
+			}
+		}
+	}
+}
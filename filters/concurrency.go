@@ -0,0 +1,208 @@
+package filters
+
+import (
+	"container/list"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cosiner/roboot"
+)
+
+type RequestPriority uint8
+
+const (
+	PriorityNormal RequestPriority = iota
+	PriorityLow                    // shed first, evicted from queue by higher priorities
+	PriorityHigh                   // served ahead of lower priorities in queue
+	PriorityBypass                 // never limited, such as health checks
+)
+
+var priorityRanks = [...]int{PriorityLow: 0, PriorityNormal: 1, PriorityHigh: 2}
+
+type ConcurrencyLimit struct {
+	Name          string // label value of metrics
+	MaxConcurrent int
+	MaxQueue      int           // max waiting requests, zero means shedding immediately
+	QueueTimeout  time.Duration // max waiting time in queue, default 1s
+	RetryAfter    time.Duration // Retry-After header when shedding, default 1s
+
+	Priority func(ctx *roboot.Context) RequestPriority // default PriorityNormal for all
+}
+
+type concurrencyWaiter struct {
+	ready    chan struct{}
+	elem     *list.Element
+	done     bool
+	admitted bool
+}
+
+// ConcurrencyLimiter cap concurrent in-flight requests passing through it, attach it to
+// "/*" to limit globally, or to the paths of a route group to limit the group.
+type ConcurrencyLimiter struct {
+	name          string
+	maxConcurrent int
+	maxQueue      int
+	queueTimeout  time.Duration
+	retryAfter    string
+	priority      func(ctx *roboot.Context) RequestPriority
+
+	mu      sync.Mutex
+	running int
+	queued  int
+	queues  [PriorityHigh + 1]list.List
+	shed    uint64
+}
+
+var _ roboot.Filter = &ConcurrencyLimiter{}
+
+func NewConcurrencyLimiter(c ConcurrencyLimit) *ConcurrencyLimiter {
+	const (
+		defaultQueueTimeout = time.Second
+		defaultRetryAfter   = time.Second
+	)
+	if c.MaxConcurrent <= 0 {
+		panic("max concurrent should be positive")
+	}
+	l := &ConcurrencyLimiter{
+		name:          c.Name,
+		maxConcurrent: c.MaxConcurrent,
+		maxQueue:      c.MaxQueue,
+		queueTimeout:  c.QueueTimeout,
+		priority:      c.Priority,
+	}
+	if l.queueTimeout <= 0 {
+		l.queueTimeout = defaultQueueTimeout
+	}
+	if c.RetryAfter <= 0 {
+		c.RetryAfter = defaultRetryAfter
+	}
+	l.retryAfter = ceilSeconds(c.RetryAfter)
+	return l
+}
+
+// evictLower reject the newest waiter whose priority is lower than p.
+func (l *ConcurrencyLimiter) evictLower(p RequestPriority) bool {
+	for _, lower := range []RequestPriority{PriorityLow, PriorityNormal} {
+		if priorityRanks[lower] >= priorityRanks[p] {
+			return false
+		}
+		q := &l.queues[lower]
+		if back := q.Back(); back != nil {
+			l.finishWaiter(q.Remove(back).(*concurrencyWaiter), false)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *ConcurrencyLimiter) finishWaiter(w *concurrencyWaiter, admitted bool) {
+	l.queued--
+	w.done = true
+	w.admitted = admitted
+	close(w.ready)
+}
+
+func (l *ConcurrencyLimiter) acquire(ctx *roboot.Context, p RequestPriority) bool {
+	l.mu.Lock()
+	if l.running < l.maxConcurrent {
+		l.running++
+		l.mu.Unlock()
+		return true
+	}
+	if l.queued >= l.maxQueue && !l.evictLower(p) {
+		l.mu.Unlock()
+		return false
+	}
+	w := &concurrencyWaiter{
+		ready: make(chan struct{}),
+	}
+	w.elem = l.queues[p].PushBack(w)
+	l.queued++
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+		return w.admitted
+	case <-timer.C:
+	case <-ctx.Req.Context().Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !w.done {
+		l.queues[p].Remove(w.elem)
+		l.finishWaiter(w, false)
+	}
+	return w.admitted
+}
+
+func (l *ConcurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, p := range []RequestPriority{PriorityHigh, PriorityNormal, PriorityLow} {
+		q := &l.queues[p]
+		if front := q.Front(); front != nil {
+			// hand over the slot to waiter directly
+			l.finishWaiter(q.Remove(front).(*concurrencyWaiter), true)
+			return
+		}
+	}
+	l.running--
+}
+
+var errOverloaded = errors.New("server is overloaded")
+
+func (l *ConcurrencyLimiter) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	p := PriorityNormal
+	if l.priority != nil {
+		p = l.priority(ctx)
+	}
+	if p == PriorityBypass {
+		chain.Handle(ctx)
+		return
+	}
+	if p > PriorityHigh {
+		p = PriorityHigh
+	}
+
+	if !l.acquire(ctx, p) {
+		l.mu.Lock()
+		l.shed++
+		l.mu.Unlock()
+		ctx.Resp.Header().Set(roboot.HeaderRetryAfter, l.retryAfter)
+		ctx.Error(errOverloaded, http.StatusServiceUnavailable)
+		return
+	}
+	defer l.release()
+	chain.Handle(ctx)
+}
+
+func (l *ConcurrencyLimiter) CollectMetrics() []MetricFamily {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	labels := []string{"limiter", l.name}
+	return []MetricFamily{
+		{
+			Name:    "concurrency_limiter_running",
+			Help:    "Number of requests being served by the limiter.",
+			Type:    MetricGauge,
+			Samples: []MetricSample{{Labels: labels, Value: float64(l.running)}},
+		},
+		{
+			Name:    "concurrency_limiter_queued",
+			Help:    "Number of requests waiting in queue.",
+			Type:    MetricGauge,
+			Samples: []MetricSample{{Labels: labels, Value: float64(l.queued)}},
+		},
+		{
+			Name:    "concurrency_limiter_shed_total",
+			Help:    "Total number of requests rejected.",
+			Type:    MetricCounter,
+			Samples: []MetricSample{{Labels: labels, Value: float64(l.shed)}},
+		},
+	}
+}
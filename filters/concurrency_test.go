@@ -0,0 +1,132 @@
+package filters_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func newConcurrencyServer(t *testing.T, limit filters.ConcurrencyLimit) (roboot.Server, *filters.ConcurrencyLimiter, chan string, chan struct{}) {
+	var (
+		entered = make(chan string, 16)
+		unblock = make(chan struct{})
+	)
+	limit.Priority = func(ctx *roboot.Context) filters.RequestPriority {
+		switch ctx.Req.Header.Get("X-Priority") {
+		case "low":
+			return filters.PriorityLow
+		case "high":
+			return filters.PriorityHigh
+		case "bypass":
+			return filters.PriorityBypass
+		}
+		return filters.PriorityNormal
+	}
+	limiter := filters.NewConcurrencyLimiter(limit)
+	s := newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		entered <- ctx.Req.Header.Get("X-Name")
+		if ctx.Req.Header.Get("X-Block") != "" {
+			<-unblock
+		}
+	}), limiter)
+	return s, limiter, entered, unblock
+}
+
+func concurrentRequest(s roboot.Server, name, priority string, block bool) <-chan *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Name", name)
+	req.Header.Set("X-Priority", priority)
+	if block {
+		req.Header.Set("X-Block", "1")
+	}
+	result := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		result <- serve(s, req)
+	}()
+	return result
+}
+
+func waitQueued(t *testing.T, limiter *filters.ConcurrencyLimiter, n float64) {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if limiter.CollectMetrics()[1].Samples[0].Value == n {
+			return
+		}
+	}
+	t.Fatalf("expect %v requests queued", n)
+}
+
+func TestConcurrencyLimiterPriority(t *testing.T) {
+	s, limiter, entered, unblock := newConcurrencyServer(t, filters.ConcurrencyLimit{
+		MaxConcurrent: 1,
+		MaxQueue:      1,
+		QueueTimeout:  time.Minute,
+	})
+
+	running := concurrentRequest(s, "running", "", true)
+	if name := <-entered; name != "running" {
+		t.Fatalf("expect running request entered, got %s", name)
+	}
+	if resp := <-concurrentRequest(s, "bypass", "bypass", false); resp.Code != http.StatusOK || <-entered != "bypass" {
+		t.Fatalf("expect bypass request served, got %d", resp.Code)
+	}
+
+	low := concurrentRequest(s, "low", "low", false)
+	waitQueued(t, limiter, 1)
+	high := concurrentRequest(s, "high", "high", false)
+	if resp := <-low; resp.Code != http.StatusServiceUnavailable || resp.Header().Get(roboot.HeaderRetryAfter) != "1" {
+		t.Fatalf("expect low priority request evicted, got %d", resp.Code)
+	}
+	waitQueued(t, limiter, 1)
+	if resp := <-concurrentRequest(s, "normal", "", false); resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expect normal priority request shed, got %d", resp.Code)
+	}
+
+	close(unblock)
+	for name, result := range map[string]<-chan *httptest.ResponseRecorder{"running": running, "high": high} {
+		if resp := <-result; resp.Code != http.StatusOK {
+			t.Errorf("expect %s request served, got %d", name, resp.Code)
+		}
+	}
+	if name := <-entered; name != "high" {
+		t.Errorf("expect queued high priority request served, got %s", name)
+	}
+	if shed := limiter.CollectMetrics()[2].Samples[0].Value; shed != 2 {
+		t.Errorf("expect 2 requests shed, got %v", shed)
+	}
+	if running := limiter.CollectMetrics()[0].Samples[0].Value; running != 0 {
+		t.Errorf("expect no running requests, got %v", running)
+	}
+}
+
+func TestConcurrencyLimiterQueueTimeout(t *testing.T) {
+	s, limiter, entered, unblock := newConcurrencyServer(t, filters.ConcurrencyLimit{
+		MaxConcurrent: 1,
+		MaxQueue:      1,
+		QueueTimeout:  20 * time.Millisecond,
+		RetryAfter:    1500 * time.Millisecond,
+	})
+	running := concurrentRequest(s, "running", "", true)
+	<-entered
+
+	begin := time.Now()
+	resp := <-concurrentRequest(s, "waiting", "", false)
+	if resp.Code != http.StatusServiceUnavailable || resp.Header().Get(roboot.HeaderRetryAfter) != "2" {
+		t.Fatalf("expect 503 with Retry-After 2, got %d %s", resp.Code, resp.Header().Get(roboot.HeaderRetryAfter))
+	}
+	if elapsed := time.Since(begin); elapsed < 20*time.Millisecond {
+		t.Errorf("expect request waiting in queue, got %s", elapsed)
+	}
+	waitQueued(t, limiter, 0)
+
+	close(unblock)
+	if resp := <-running; resp.Code != http.StatusOK {
+		t.Errorf("expect running request served, got %d", resp.Code)
+	}
+	if resp := <-concurrentRequest(s, "next", "", false); resp.Code != http.StatusOK {
+		t.Errorf("expect slot released, got %d", resp.Code)
+	}
+}
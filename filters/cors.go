@@ -2,23 +2,39 @@ package filters
 
 import (
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/cosiner/roboot"
 )
 
+// CORS add cross-origin headers for allowed origins, requests from other origins are
+// processed without these headers, and browsers will block them.
 type CORS struct {
-	Origins          []string
+	Origins          []string // "*" allow all, "https://*.example.com" allow all subdomains
+	OriginRegexps    []string // origins matched by these regexps are allowed, invalid regexp panics
+	AllowOriginFunc  func(ctx *roboot.Context, origin string) bool
 	Methods          []string
 	Headers          []string
 	ExposeHeaders    []string // these headers can be accessed by javascript
 	PreflightMaxage  int      // max efficient seconds of browser preflight
 	AllowCredentials bool
+	// response Access-Control-Allow-Private-Network for private network access preflight
+	AllowPrivateNetwork bool
+}
+
+type corsWildcard struct {
+	prefix string
+	suffix string
 }
 
 type corsFilter struct {
-	origins []string
+	allowAll        bool
+	origins         map[string]bool
+	wildcards       []corsWildcard
+	regexps         []*regexp.Regexp
+	allowOriginFunc func(ctx *roboot.Context, origin string) bool
 
 	methods          []string
 	methodsStr       string
@@ -26,14 +42,31 @@ type corsFilter struct {
 	headersStr       string
 	exposeHeadersStr string
 
-	preflightMaxage  string
-	allowCredentials string
+	preflightMaxage     string
+	allowCredentials    string
+	allowPrivateNetwork bool
 }
 
 func (c *CORS) ToFilter() roboot.Filter {
 	var f corsFilter
-	if l := len(c.Origins); l > 0 && (l != 1 || c.Origins[0] != "*") {
-		f.origins = c.Origins
+	f.origins = make(map[string]bool)
+	for _, origin := range c.Origins {
+		origin = strings.ToLower(origin)
+		switch i := strings.IndexByte(origin, '*'); {
+		case origin == "*":
+			f.allowAll = true
+		case i >= 0:
+			f.wildcards = append(f.wildcards, corsWildcard{prefix: origin[:i], suffix: origin[i+1:]})
+		default:
+			f.origins[origin] = true
+		}
+	}
+	for _, r := range c.OriginRegexps {
+		f.regexps = append(f.regexps, regexp.MustCompile(r))
+	}
+	f.allowOriginFunc = c.AllowOriginFunc
+	if len(c.Origins) == 0 && len(f.regexps) == 0 && f.allowOriginFunc == nil {
+		f.allowAll = true
 	}
 
 	f.methods = c.Methods
@@ -42,12 +75,12 @@ func (c *CORS) ToFilter() roboot.Filter {
 	}
 	f.methodsStr = strings.Join(f.methods, ",")
 
-	f.headers = c.Headers
-	if len(f.headers) == 0 {
-		f.headers = []string{roboot.HeaderOrigin, roboot.HeaderAccept, roboot.HeaderContentType, roboot.HeaderAuthorization}
+	headers := c.Headers
+	if len(headers) == 0 {
+		headers = []string{roboot.HeaderOrigin, roboot.HeaderAccept, roboot.HeaderContentType, roboot.HeaderAuthorization}
 	}
-	for i := range f.headers {
-		f.headers[i] = strings.ToLower(f.headers[i]) // chrome browser will use lower header
+	for _, h := range headers {
+		f.headers = append(f.headers, strings.ToLower(h)) // chrome browser will use lower header
 	}
 	f.headersStr = strings.Join(f.headers, ",")
 
@@ -55,47 +88,53 @@ func (c *CORS) ToFilter() roboot.Filter {
 	if c.AllowCredentials {
 		f.allowCredentials = strconv.FormatBool(c.AllowCredentials)
 	}
+	f.allowPrivateNetwork = c.AllowPrivateNetwork
 
 	const defaultPreflightMaxAge = 3600
-	if c.PreflightMaxage == 0 {
-		c.PreflightMaxage = defaultPreflightMaxAge
+	maxAge := c.PreflightMaxage
+	if maxAge == 0 {
+		maxAge = defaultPreflightMaxAge
 	}
-	if c.PreflightMaxage > 0 {
-		f.preflightMaxage = strconv.Itoa(c.PreflightMaxage)
+	if maxAge > 0 {
+		f.preflightMaxage = strconv.Itoa(maxAge)
 	}
 
 	return &f
 }
 
-func (c *corsFilter) checkOrigin(origin string) bool {
-	if origin == "" {
+func (c *corsFilter) checkOrigin(ctx *roboot.Context, origin string) bool {
+	if c.allowAll {
 		return true
 	}
-
-	var has bool
-	for i := 0; i < len(c.origins) && !has; i++ {
-		has = c.origins[i] == origin
+	lower := strings.ToLower(origin)
+	if c.origins[lower] {
+		return true
 	}
-	return has
+	for _, w := range c.wildcards {
+		if len(lower) > len(w.prefix)+len(w.suffix) && strings.HasPrefix(lower, w.prefix) && strings.HasSuffix(lower, w.suffix) {
+			return true
+		}
+	}
+	for _, r := range c.regexps {
+		if r.MatchString(origin) {
+			return true
+		}
+	}
+	return c.allowOriginFunc != nil && c.allowOriginFunc(ctx, origin)
 }
 
-func (c *corsFilter) setHeaders(ctx *roboot.Context, origin string) {
-	headers := ctx.Resp.Header()
-	headers.Set(roboot.HeaderCorsAllowOrigin, origin)
-	headers.Set(roboot.HeaderCorsAllowMethods, c.methodsStr)
-	headers.Set(roboot.HeaderCorsAllowHeaders, c.headersStr)
+func (c *corsFilter) setOriginHeaders(headers http.Header, origin string) {
+	if c.allowAll && c.allowCredentials == "" {
+		headers.Set(roboot.HeaderCorsAllowOrigin, "*")
+	} else {
+		headers.Set(roboot.HeaderCorsAllowOrigin, origin)
+	}
 	if c.allowCredentials != "" {
 		headers.Set(roboot.HeaderCorsAllowCredentials, c.allowCredentials)
 	}
-	if c.exposeHeadersStr != "" {
-		headers.Set(roboot.HeaderCorsExposeHeaders, c.exposeHeadersStr)
-	}
-	if c.preflightMaxage != "" {
-		headers.Set(roboot.HeaderCorsMaxAge, c.preflightMaxage)
-	}
 }
 
-func (c *corsFilter) preflight(ctx *roboot.Context, method, headers, origin string) {
+func (c *corsFilter) allowRequest(method, headers string) bool {
 	var allowMethod bool
 	for _, m := range c.methods {
 		if m == method {
@@ -104,8 +143,7 @@ func (c *corsFilter) preflight(ctx *roboot.Context, method, headers, origin stri
 		}
 	}
 	if !allowMethod {
-		ctx.Status(http.StatusForbidden)
-		return
+		return false
 	}
 
 	var hdrs []string
@@ -114,6 +152,9 @@ func (c *corsFilter) preflight(ctx *roboot.Context, method, headers, origin stri
 	}
 	for _, h := range hdrs {
 		h = strings.ToLower(strings.TrimSpace(h))
+		if h == "" {
+			continue
+		}
 
 		var allowHeader bool
 		for _, ch := range c.headers {
@@ -123,32 +164,53 @@ func (c *corsFilter) preflight(ctx *roboot.Context, method, headers, origin stri
 			}
 		}
 		if !allowHeader {
-			ctx.Status(http.StatusForbidden)
-			return
+			return false
 		}
 	}
-
-	c.setHeaders(ctx, origin)
-	ctx.Status(http.StatusOK)
+	return true
 }
 
-func (c *corsFilter) filter(ctx *roboot.Context, chain roboot.Handler, origin string) {
-	c.setHeaders(ctx, origin)
-	chain.Handle(ctx)
+func (c *corsFilter) preflight(ctx *roboot.Context, method, origin string, allowed bool) {
+	var (
+		reqHeaders = ctx.Req.Header
+		headers    = ctx.Resp.Header()
+	)
+	if allowed && c.allowRequest(method, reqHeaders.Get(roboot.HeaderCorsRequestHeaders)) {
+		c.setOriginHeaders(headers, origin)
+		headers.Set(roboot.HeaderCorsAllowMethods, c.methodsStr)
+		headers.Set(roboot.HeaderCorsAllowHeaders, c.headersStr)
+		if c.preflightMaxage != "" {
+			headers.Set(roboot.HeaderCorsMaxAge, c.preflightMaxage)
+		}
+		if c.allowPrivateNetwork && reqHeaders.Get(roboot.HeaderCorsRequestPrivateNetwork) == "true" {
+			headers.Set(roboot.HeaderCorsAllowPrivateNetwork, "true")
+		}
+	}
+	ctx.Status(http.StatusNoContent)
 }
 
 func (c *corsFilter) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	headers := ctx.Resp.Header()
+	if !c.allowAll || c.allowCredentials != "" {
+		addVary(headers, roboot.HeaderOrigin)
+	}
 	origin := ctx.Req.Header.Get(roboot.HeaderOrigin)
-	if len(c.origins) != 0 && !c.checkOrigin(origin) {
-		ctx.Status(http.StatusForbidden)
+	if origin == "" {
+		chain.Handle(ctx)
 		return
 	}
 
+	allowed := c.checkOrigin(ctx, origin)
 	reqMethod := ctx.Req.Header.Get(roboot.HeaderCorsRequestMethod)
-	reqHeaders := ctx.Req.Header.Get(roboot.HeaderCorsRequestHeaders)
-	if ctx.Req.Method == roboot.MethodOptions && (reqMethod != "" || reqHeaders != "") {
-		c.preflight(ctx, reqMethod, reqHeaders, origin)
-	} else {
-		c.filter(ctx, chain, origin)
+	if ctx.Req.Method == roboot.MethodOptions && reqMethod != "" {
+		c.preflight(ctx, reqMethod, origin, allowed)
+		return
+	}
+	if allowed {
+		c.setOriginHeaders(headers, origin)
+		if c.exposeHeadersStr != "" {
+			headers.Set(roboot.HeaderCorsExposeHeaders, c.exposeHeadersStr)
+		}
 	}
+	chain.Handle(ctx)
 }
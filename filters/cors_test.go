@@ -0,0 +1,61 @@
+package filters_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func TestCORS(t *testing.T) {
+	cors := filters.CORS{
+		Origins:             []string{"https://example.com", "https://*.example.org"},
+		OriginRegexps:       []string{`^https://app-\d+\.example\.net$`},
+		AllowPrivateNetwork: true,
+	}
+	s := newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		ctx.Resp.Write([]byte("ok"))
+	}), cors.ToFilter())
+
+	tests := []struct {
+		method    string
+		origin    string
+		preflight bool
+		allowed   bool
+	}{
+		{"GET", "https://example.com", false, true},
+		{"GET", "https://api.example.org", false, true},
+		{"GET", "https://example.org", false, false},
+		{"GET", "https://app-12.example.net", false, true},
+		{"GET", "https://evil.com", false, false},
+		{"OPTIONS", "https://example.com", true, true},
+		{"OPTIONS", "https://evil.com", true, false},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, "/", nil)
+		req.Header.Set(roboot.HeaderOrigin, test.origin)
+		if test.preflight {
+			req.Header.Set(roboot.HeaderCorsRequestMethod, "PUT")
+			req.Header.Set(roboot.HeaderCorsRequestPrivateNetwork, "true")
+		}
+		resp := serve(s, req)
+		header := resp.Header()
+		if resp.Code >= http.StatusBadRequest {
+			t.Errorf("%s %s: unexpected status %d", test.method, test.origin, resp.Code)
+		}
+		if allowed := header.Get(roboot.HeaderCorsAllowOrigin) == test.origin; allowed != test.allowed {
+			t.Errorf("%s %s: expect allowed %t", test.method, test.origin, test.allowed)
+		}
+		if header.Get(roboot.HeaderVary) != roboot.HeaderOrigin {
+			t.Errorf("%s %s: vary header is not set", test.method, test.origin)
+		}
+		hasMethods := header.Get(roboot.HeaderCorsAllowMethods) != ""
+		if hasMethods != (test.preflight && test.allowed) {
+			t.Errorf("%s %s: allow methods should only be sent for allowed preflight", test.method, test.origin)
+		}
+		if test.preflight && test.allowed && header.Get(roboot.HeaderCorsAllowPrivateNetwork) != "true" {
+			t.Errorf("%s %s: private network should be allowed", test.method, test.origin)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package filters
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cosiner/roboot"
+)
+
+var (
+	ErrUnsupportedContentEncoding = errors.New("unsupported content encoding")
+	ErrBodyTooLarge               = errors.New("decompressed request body is too large")
+)
+
+// Decompress decode gzip and deflate request bodies by Content-Encoding, the body is
+// decompressed before handlers to reject bodies exceeds MaxSize.
+type Decompress struct {
+	MaxSize int64 // max decompressed size, default 10M
+}
+
+type decompressFilter struct {
+	maxSize int64
+}
+
+func (d *Decompress) ToFilter() roboot.Filter {
+	const defaultMaxSize = 10 << 20
+	f := decompressFilter{
+		maxSize: d.MaxSize,
+	}
+	if f.maxSize <= 0 {
+		f.maxSize = defaultMaxSize
+	}
+	return &f
+}
+
+// newDeflateReader accept both zlib wrapped stream and raw deflate stream, the latter
+// is sent by some clients for the deflate encoding.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+func (f *decompressFilter) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	encoding := strings.ToLower(strings.TrimSpace(ctx.Req.Header.Get(roboot.HeaderContentEncoding)))
+	if encoding == "" || encoding == "identity" || ctx.Req.Body == nil {
+		chain.Handle(ctx)
+		return
+	}
+
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	switch encoding {
+	case roboot.ContentEncodingGzip, "x-gzip":
+		r, err = gzip.NewReader(ctx.Req.Body)
+	case roboot.ContentEncodingDeflate:
+		r, err = newDeflateReader(ctx.Req.Body)
+	default:
+		ctx.Error(ErrUnsupportedContentEncoding, http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		ctx.Error(err, http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r, f.maxSize+1))
+	r.Close()
+	ctx.Req.Body.Close()
+	if err != nil {
+		ctx.Error(err, http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > f.maxSize {
+		ctx.Error(ErrBodyTooLarge, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	ctx.Req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	ctx.Req.ContentLength = int64(len(body))
+	ctx.Req.Header.Del(roboot.HeaderContentEncoding)
+	ctx.Req.Header.Set(roboot.HeaderContentLength, strconv.Itoa(len(body)))
+	chain.Handle(ctx)
+}
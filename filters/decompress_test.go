@@ -0,0 +1,51 @@
+package filters_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func TestDecompress(t *testing.T) {
+	s := newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		body, _ := ioutil.ReadAll(ctx.Req.Body)
+		ctx.Resp.Write(body)
+	}), (&filters.Decompress{MaxSize: 100}).ToFilter())
+
+	gzipped := func(s string) *bytes.Buffer {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(s))
+		w.Close()
+		return &buf
+	}
+	tests := []struct {
+		encoding string
+		body     *bytes.Buffer
+		status   int
+		resp     string
+	}{
+		{"", bytes.NewBufferString("plain"), http.StatusOK, "plain"},
+		{"gzip", gzipped(`{"a":1}`), http.StatusOK, `{"a":1}`},
+		{"gzip", gzipped(strings.Repeat("a", 101)), http.StatusRequestEntityTooLarge, ""},
+		{"gzip", bytes.NewBufferString("invalid"), http.StatusBadRequest, ""},
+		{"br", bytes.NewBufferString("data"), http.StatusUnsupportedMediaType, ""},
+	}
+	for i, test := range tests {
+		req, _ := http.NewRequest("POST", "/", test.body)
+		req.Header.Set(roboot.HeaderContentEncoding, test.encoding)
+		resp := serve(s, req)
+		if resp.Code != test.status {
+			t.Errorf("%d: expect status %d, got %d", i, test.status, resp.Code)
+		}
+		if test.resp != "" && resp.Body.String() != test.resp {
+			t.Errorf("%d: expect body %s, got %s", i, test.resp, resp.Body.String())
+		}
+	}
+}
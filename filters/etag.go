@@ -0,0 +1,132 @@
+package filters
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/cosiner/roboot"
+)
+
+type etagWriter struct {
+	roboot.ResponseWriter
+	code        int
+	buf         bytes.Buffer
+	maxSize     int
+	passthrough bool
+}
+
+func (w *etagWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+	} else if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *etagWriter) flush() {
+	w.passthrough = true
+	if w.code != 0 {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+	if w.buf.Len() > 0 {
+		w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if !w.passthrough && w.buf.Len()+len(b) > w.maxSize {
+		w.flush()
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.buf.Write(b)
+}
+
+func (w *etagWriter) StatusCode() int {
+	if w.passthrough || w.code == 0 {
+		return w.ResponseWriter.StatusCode()
+	}
+	return w.code
+}
+
+func (w *etagWriter) BytesWritten() int64 {
+	return w.ResponseWriter.BytesWritten() + int64(w.buf.Len())
+}
+
+// ETag buffer responses of GET and HEAD requests, compute ETag for successful responses
+// if the handler didn't set it, and answer conditional requests with 304 or 412.
+type ETag struct {
+	Weak    bool
+	MaxSize int // responses larger than it are not buffered and tagged, default 1M
+}
+
+type etagFilter struct {
+	weak    bool
+	maxSize int
+}
+
+func (e *ETag) ToFilter() roboot.Filter {
+	const defaultMaxSize = 1 << 20
+	f := etagFilter{
+		weak:    e.Weak,
+		maxSize: e.MaxSize,
+	}
+	if f.maxSize <= 0 {
+		f.maxSize = defaultMaxSize
+	}
+	return &f
+}
+
+func (f *etagFilter) etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if f.weak {
+		etag = "W/" + etag
+	}
+	return etag
+}
+
+func (f *etagFilter) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	if ctx.Req.Method != roboot.MethodGet && ctx.Req.Method != roboot.MethodHead {
+		chain.Handle(ctx)
+		return
+	}
+
+	var (
+		resp = ctx.Resp
+		ew   = etagWriter{
+			ResponseWriter: resp,
+			maxSize:        f.maxSize,
+		}
+	)
+	ctx.Resp = &ew
+	chain.Handle(ctx)
+	ctx.Resp = resp
+	if ew.passthrough {
+		return
+	}
+
+	headers := resp.Header()
+	etag := headers.Get(roboot.HeaderETag)
+	if ew.code == 0 || ew.code == http.StatusOK {
+		if etag == "" && ew.buf.Len() > 0 {
+			etag = f.etag(ew.buf.Bytes())
+		}
+		var modTime time.Time
+		if lastModified := headers.Get(roboot.HeaderLastModified); lastModified != "" {
+			modTime, _ = http.ParseTime(lastModified)
+		}
+		if !ctx.CheckModified(etag, modTime) {
+			return
+		}
+	}
+	ew.flush()
+}
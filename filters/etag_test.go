@@ -0,0 +1,45 @@
+package filters_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func TestETag(t *testing.T) {
+	s := newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		ctx.Resp.Write([]byte("hello"))
+	}), (&filters.ETag{}).ToFilter())
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	resp := serve(s, req)
+	etag := resp.Header().Get(roboot.HeaderETag)
+	if resp.Code != http.StatusOK || resp.Body.String() != "hello" || etag == "" {
+		t.Fatalf("unexpected response: %d %s %s", resp.Code, resp.Body.String(), etag)
+	}
+
+	tests := []struct {
+		header string
+		value  string
+		status int
+	}{
+		{roboot.HeaderIfNoneMatch, etag, http.StatusNotModified},
+		{roboot.HeaderIfNoneMatch, "W/" + etag, http.StatusNotModified},
+		{roboot.HeaderIfNoneMatch, `"other"`, http.StatusOK},
+		{roboot.HeaderIfMatch, etag, http.StatusOK},
+		{roboot.HeaderIfMatch, `"other"`, http.StatusPreconditionFailed},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(test.header, test.value)
+		resp := serve(s, req)
+		if resp.Code != test.status {
+			t.Errorf("%s %s: expect status %d, got %d", test.header, test.value, test.status, resp.Code)
+		}
+		if test.status != http.StatusOK && resp.Body.Len() != 0 {
+			t.Errorf("%s %s: body should be empty", test.header, test.value)
+		}
+	}
+}
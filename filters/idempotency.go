@@ -0,0 +1,301 @@
+package filters
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cosiner/roboot"
+)
+
+type IdempotencyRecord struct {
+	Fingerprint string // identify the request payload, reusing key with different payload is rejected
+	Status      int
+	Header      http.Header
+	Body        []byte
+	Omitted     bool // response is too large to be stored, retries are rejected instead of replayed
+}
+
+type IdempotencyStore interface {
+	// Begin lock the key for processing, if the key has been completed, the stored record
+	// is returned, if the key is being processed by others, locked is false.
+	Begin(key string) (record *IdempotencyRecord, locked bool, err error)
+	// Complete store the record and unlock the key.
+	Complete(key string, record *IdempotencyRecord) error
+	// Release unlock the key without storing, so that the request can be retried.
+	Release(key string) error
+}
+
+type idempotencyEntry struct {
+	record  *IdempotencyRecord
+	expires time.Time
+}
+
+type memoryIdempotencyStore struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+// NewMemoryIdempotencyStore create a in-memory store, records are kept for ttl, default
+// 24 hours.
+func NewMemoryIdempotencyStore(ttl time.Duration) IdempotencyStore {
+	const defaultTTL = 24 * time.Hour
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return &memoryIdempotencyStore{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+func (s *memoryIdempotencyStore) Begin(key string) (*IdempotencyRecord, bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= time.Minute {
+		for k, e := range s.entries {
+			if e.record != nil && now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	e := s.entries[key]
+	if e == nil || (e.record != nil && now.After(e.expires)) {
+		s.entries[key] = &idempotencyEntry{}
+		return nil, true, nil
+	}
+	if e.record == nil {
+		return nil, false, nil
+	}
+	return e.record, false, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(key string, record *IdempotencyRecord) error {
+	s.mu.Lock()
+	s.entries[key] = &idempotencyEntry{
+		record:  record,
+		expires: time.Now().Add(s.ttl),
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	if e := s.entries[key]; e != nil && e.record == nil {
+		delete(s.entries, key)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Idempotency implement the Idempotency-Key header pattern for unsafe methods, the first
+// response of each key and principal is stored and replayed for retries. Server errors
+// are not stored so that the request can be retried, retries of responses too large to
+// be stored are rejected with 409.
+type Idempotency struct {
+	Header       string                           // default Idempotency-Key
+	Methods      []string                         // default POST and PATCH
+	Principal    func(ctx *roboot.Context) string // scope of keys such as user id, default IdempotencyPrincipal
+	Store        IdempotencyStore                 // default NewMemoryIdempotencyStore(0)
+	Required     bool                             // reject requests without key
+	MaxEntrySize int                              // responses larger than it are not stored, default 1M
+	MaxBodySize  int64                            // requests with larger body are rejected, default 1M
+}
+
+type idempotencyFilter struct {
+	header       string
+	methods      []string
+	principal    func(ctx *roboot.Context) string
+	store        IdempotencyStore
+	required     bool
+	maxEntrySize int
+	maxBodySize  int64
+}
+
+var (
+	ErrIdempotencyKeyMissing   = errors.New("idempotency key is missing")
+	ErrIdempotencyKeyInFlight  = errors.New("request with same idempotency key is being processed")
+	ErrIdempotencyKeyReused    = errors.New("idempotency key is reused with different request")
+	ErrIdempotencyKeyCompleted = errors.New("request with same idempotency key has been processed, but the response is not stored")
+	ErrRequestBodyTooLarge     = errors.New("request body is too large")
+)
+
+// IdempotencyPrincipal scope keys by roboot.ContextValuePrincipal set by authentication
+// filters placed before it, or the Authorization header which changes when tokens are
+// refreshed. Unauthenticated requests are scoped by client ip, it's shared behind NAT
+// and changes on mobile networks, so they are only as safe as the entropy of keys.
+func IdempotencyPrincipal(ctx *roboot.Context) string {
+	if principal, ok := ctx.ContextValue(roboot.ContextValuePrincipal).(string); ok && principal != "" {
+		return "principal " + principal
+	}
+	if auth := ctx.Req.Header.Get(roboot.HeaderAuthorization); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		return "authorization " + hex.EncodeToString(sum[:])
+	}
+	return "ip " + ctx.ClientIP()
+}
+
+func (i *Idempotency) ToFilter() roboot.Filter {
+	const (
+		defaultMaxEntrySize = 1 << 20
+		defaultMaxBodySize  = 1 << 20
+	)
+	f := idempotencyFilter{
+		header:       i.Header,
+		methods:      i.Methods,
+		principal:    i.Principal,
+		store:        i.Store,
+		required:     i.Required,
+		maxEntrySize: i.MaxEntrySize,
+		maxBodySize:  i.MaxBodySize,
+	}
+	if f.header == "" {
+		f.header = roboot.HeaderIdempotencyKey
+	}
+	if len(f.methods) == 0 {
+		f.methods = []string{roboot.MethodPost, roboot.MethodPatch}
+	}
+	if f.principal == nil {
+		f.principal = IdempotencyPrincipal
+	}
+	if f.store == nil {
+		f.store = NewMemoryIdempotencyStore(0)
+	}
+	if f.maxBodySize <= 0 {
+		f.maxBodySize = defaultMaxBodySize
+	}
+	if f.maxEntrySize <= 0 {
+		f.maxEntrySize = defaultMaxEntrySize
+	}
+	return &f
+}
+
+func (f *idempotencyFilter) fingerprint(ctx *roboot.Context) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(ctx.Req.Method + " " + ctx.Req.URL.RequestURI() + "\n"))
+	if ctx.Req.Body != nil {
+		body, err := ioutil.ReadAll(io.LimitReader(ctx.Req.Body, f.maxBodySize+1))
+		ctx.Req.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		if int64(len(body)) > f.maxBodySize {
+			return "", ErrRequestBodyTooLarge
+		}
+		ctx.Req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (f *idempotencyFilter) replay(ctx *roboot.Context, record *IdempotencyRecord) {
+	header := ctx.Resp.Header()
+	for k, v := range record.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	header.Set(roboot.HeaderIdempotentReplayed, "true")
+	ctx.Status(record.Status)
+	ctx.Resp.Write(record.Body)
+}
+
+func (f *idempotencyFilter) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	var isMethod bool
+	for _, m := range f.methods {
+		if m == ctx.Req.Method {
+			isMethod = true
+			break
+		}
+	}
+	if !isMethod {
+		chain.Handle(ctx)
+		return
+	}
+	key := ctx.Req.Header.Get(f.header)
+	if key == "" {
+		if f.required {
+			ctx.Error(ErrIdempotencyKeyMissing, http.StatusBadRequest)
+		} else {
+			chain.Handle(ctx)
+		}
+		return
+	}
+	key = f.principal(ctx) + "\n" + key
+
+	fingerprint, err := f.fingerprint(ctx)
+	if err == ErrRequestBodyTooLarge {
+		ctx.Error(err, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		ctx.Error(err, http.StatusBadRequest)
+		return
+	}
+	record, locked, err := f.store.Begin(key)
+	if err != nil {
+		ctx.Error(err, http.StatusInternalServerError)
+		return
+	}
+	if !locked {
+		switch {
+		case record == nil:
+			ctx.Error(ErrIdempotencyKeyInFlight, http.StatusConflict)
+		case record.Fingerprint != fingerprint:
+			ctx.Error(ErrIdempotencyKeyReused, http.StatusUnprocessableEntity)
+		case record.Omitted:
+			ctx.Error(ErrIdempotencyKeyCompleted, http.StatusConflict)
+		default:
+			f.replay(ctx, record)
+		}
+		return
+	}
+
+	// release the key if the handler panics or the response is not stored
+	var completed bool
+	defer func() {
+		if !completed {
+			f.store.Release(key)
+		}
+	}()
+	r := newCacheRecorder(ctx.Resp, f.maxEntrySize)
+	resp := ctx.Resp
+	ctx.Resp = r
+	chain.Handle(ctx)
+	ctx.Resp = resp
+	r.syncHeader()
+
+	status := r.StatusCode()
+	if status >= http.StatusInternalServerError {
+		return
+	}
+	record = &IdempotencyRecord{
+		Fingerprint: fingerprint,
+		Status:      status,
+	}
+	if r.tooLarge {
+		// the handler has taken effect, so the key must not be reused
+		record.Omitted = true
+	} else {
+		record.Header = r.recordedHeader()
+		record.Header.Del(roboot.HeaderSetCookie)
+		record.Body = append([]byte(nil), r.buf.Bytes()...)
+	}
+	err = f.store.Complete(key, record)
+	if err != nil {
+		ctx.Env().Error.Log(ctx, roboot.ErrTypeHandle, err)
+		return
+	}
+	completed = true
+}
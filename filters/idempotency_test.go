@@ -0,0 +1,124 @@
+package filters_test
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func TestIdempotency(t *testing.T) {
+	var count int
+	s := newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		count++
+		ctx.Status(http.StatusCreated)
+		ctx.Resp.Write([]byte(strconv.Itoa(count)))
+	}), (&filters.Idempotency{Required: true, MaxBodySize: 4}).ToFilter())
+
+	post := func(key, body string) *http.Request {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(roboot.HeaderIdempotencyKey, key)
+		}
+		return req
+	}
+	postAs := func(auth, key, body string) *http.Request {
+		req := post(key, body)
+		req.Header.Set(roboot.HeaderAuthorization, auth)
+		return req
+	}
+	tests := []struct {
+		req      *http.Request
+		status   int
+		body     string
+		replayed bool
+	}{
+		{post("", "a"), http.StatusBadRequest, "", false},
+		{post("k1", "a"), http.StatusCreated, "1", false},
+		{post("k1", "a"), http.StatusCreated, "1", true},
+		{post("k1", "b"), http.StatusUnprocessableEntity, "", false},
+		{post("k2", "a"), http.StatusCreated, "2", false},
+		{post("k3", "abcde"), http.StatusRequestEntityTooLarge, "", false},
+		{postAs("Bearer other", "k1", "a"), http.StatusCreated, "3", false},
+		{postAs("Bearer other", "k1", "a"), http.StatusCreated, "3", true},
+	}
+	for i, test := range tests {
+		resp := serve(s, test.req)
+		if resp.Code != test.status {
+			t.Fatalf("%d: expect status %d, got %d", i, test.status, resp.Code)
+		}
+		if test.body != "" && resp.Body.String() != test.body {
+			t.Errorf("%d: expect body %s, got %s", i, test.body, resp.Body.String())
+		}
+		if replayed := resp.Header().Get(roboot.HeaderIdempotentReplayed) != ""; replayed != test.replayed {
+			t.Errorf("%d: expect replayed %t", i, test.replayed)
+		}
+	}
+}
+
+func TestIdempotencyLargeResponse(t *testing.T) {
+	var count int
+	s := newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		count++
+		ctx.Status(http.StatusCreated)
+		ctx.Resp.Write([]byte(strings.Repeat("a", 10)))
+	}), (&filters.Idempotency{MaxEntrySize: 4}).ToFilter())
+
+	for i, expect := range []int{http.StatusCreated, http.StatusConflict, http.StatusConflict} {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader("a"))
+		req.Header.Set(roboot.HeaderIdempotencyKey, "k")
+		if resp := serve(s, req); resp.Code != expect {
+			t.Fatalf("%d: expect status %d, got %d", i, expect, resp.Code)
+		}
+	}
+	if count != 1 {
+		t.Errorf("expect handler executed once, got %d", count)
+	}
+}
+
+func TestIdempotencyPrincipal(t *testing.T) {
+	var count int
+	auth := roboot.FilterFunc(func(ctx *roboot.Context, chain roboot.Handler) {
+		if user := ctx.Req.Header.Get("X-User"); user != "" {
+			ctx.SetContextValue(roboot.ContextValuePrincipal, user)
+		}
+		chain.Handle(ctx)
+	})
+	s := newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		count++
+		ctx.Resp.Write([]byte(strconv.Itoa(count)))
+	}), auth, (&filters.Idempotency{}).ToFilter())
+
+	post := func(user, token, ip string) string {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader("a"))
+		req.Header.Set(roboot.HeaderIdempotencyKey, "k")
+		req.RemoteAddr = ip + ":1234"
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		if token != "" {
+			req.Header.Set(roboot.HeaderAuthorization, token)
+		}
+		return serve(s, req).Body.String()
+	}
+	tests := []struct {
+		user, token, ip string
+		body            string
+	}{
+		{"alice", "Bearer 1", "10.0.0.1", "1"},
+		{"alice", "Bearer 2", "10.0.0.2", "1"}, // token refreshed and ip changed
+		{"bob", "Bearer 1", "10.0.0.1", "2"},
+		{"", "Bearer 3", "10.0.0.1", "3"},
+		{"", "Bearer 3", "10.0.0.2", "3"},
+		{"", "", "10.0.0.1", "4"},
+		{"", "", "10.0.0.2", "5"},
+	}
+	for i, test := range tests {
+		if body := post(test.user, test.token, test.ip); body != test.body {
+			t.Errorf("%d: expect body %s, got %s", i, test.body, body)
+		}
+	}
+}
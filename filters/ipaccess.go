@@ -0,0 +1,140 @@
+package filters
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/cosiner/roboot"
+)
+
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	terminal bool
+}
+
+func (n *ipTrieNode) insert(ip net.IP, ones int) {
+	curr := n
+	for i := 0; i < ones && !curr.terminal; i++ {
+		bit := ip[i/8] >> (7 - uint(i%8)) & 1
+		if curr.children[bit] == nil {
+			curr.children[bit] = &ipTrieNode{}
+		}
+		curr = curr.children[bit]
+	}
+	curr.terminal = true
+	curr.children = [2]*ipTrieNode{} // covered by this prefix
+}
+
+func (n *ipTrieNode) contains(ip net.IP) bool {
+	curr := n
+	for i := 0; curr != nil; i++ {
+		if curr.terminal {
+			return true
+		}
+		if i == len(ip)*8 {
+			break
+		}
+		curr = curr.children[ip[i/8]>>(7-uint(i%8))&1]
+	}
+	return false
+}
+
+// IPSet is a immutable set of IPv4/IPv6 networks backed by prefix tries.
+type IPSet struct {
+	v4 ipTrieNode
+	v6 ipTrieNode
+}
+
+func NewIPSet(cidrs ...string) (*IPSet, error) {
+	nets, err := roboot.ParseCIDRs(cidrs...)
+	if err != nil {
+		return nil, err
+	}
+	var s IPSet
+	for _, n := range nets {
+		ones, bits := n.Mask.Size()
+		if ip4 := n.IP.To4(); ip4 != nil && bits == 8*net.IPv4len {
+			s.v4.insert(ip4, ones)
+		} else {
+			s.v6.insert(n.IP.To16(), ones)
+		}
+	}
+	return &s, nil
+}
+
+func (s *IPSet) Contains(ip net.IP) bool {
+	if s == nil || ip == nil {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return s.v4.contains(ip4)
+	}
+	return s.v6.contains(ip.To16())
+}
+
+type ipAccessRules struct {
+	allow *IPSet
+	deny  *IPSet
+}
+
+// IPAccess permit or reject requests by client ip, denied networks take precedence, and
+// if allowed networks is not empty, only requests from these networks are permitted.
+// It's attached to routes by Router.Filter and the lists can be reloaded at any time.
+type IPAccess struct {
+	rules atomic.Value
+}
+
+var _ roboot.Filter = &IPAccess{}
+
+func NewIPAccess(allow, deny []string) (*IPAccess, error) {
+	var a IPAccess
+	err := a.Reload(allow, deny)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (a *IPAccess) Reload(allow, deny []string) error {
+	var (
+		rules ipAccessRules
+		err   error
+	)
+	if len(allow) > 0 {
+		rules.allow, err = NewIPSet(allow...)
+		if err != nil {
+			return err
+		}
+	}
+	if len(deny) > 0 {
+		rules.deny, err = NewIPSet(deny...)
+		if err != nil {
+			return err
+		}
+	}
+	a.rules.Store(&rules)
+	return nil
+}
+
+func (a *IPAccess) Permit(ip net.IP) bool {
+	rules, _ := a.rules.Load().(*ipAccessRules)
+	if rules == nil {
+		return true
+	}
+	if rules.deny.Contains(ip) {
+		return false
+	}
+	return rules.allow == nil || rules.allow.Contains(ip)
+}
+
+var errIPForbidden = errors.New("client ip is forbidden")
+
+func (a *IPAccess) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	if !a.Permit(net.ParseIP(ctx.ClientIP())) {
+		ctx.Error(errIPForbidden, http.StatusForbidden)
+		return
+	}
+	chain.Handle(ctx)
+}
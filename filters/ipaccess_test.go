@@ -0,0 +1,43 @@
+package filters_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/cosiner/roboot/filters"
+)
+
+func TestIPAccess(t *testing.T) {
+	access, err := filters.NewIPAccess(
+		[]string{"10.0.0.0/8", "192.168.1.0/24", "2001:db8::/32"},
+		[]string{"10.1.0.0/16", "192.168.1.100"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"10.2.3.4":         true,
+		"10.1.3.4":         false,
+		"192.168.1.1":      true,
+		"192.168.1.100":    false,
+		"192.168.2.1":      false,
+		"::ffff:10.2.3.4":  true,
+		"2001:db8:1::1":    true,
+		"2001:db9::1":      false,
+		"8.8.8.8":          false,
+		"not-an-ip-at-all": false,
+	}
+	for ip, expect := range tests {
+		if got := access.Permit(net.ParseIP(ip)); got != expect {
+			t.Errorf("%s: expect %t, got %t", ip, expect, got)
+		}
+	}
+
+	if err := access.Reload(nil, []string{"8.8.8.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	if !access.Permit(net.ParseIP("192.168.2.1")) || access.Permit(net.ParseIP("8.8.8.8")) {
+		t.Fatal("reload failed")
+	}
+}
@@ -2,49 +2,176 @@ package filters
 
 import (
 	"bytes"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
 
 	"github.com/cosiner/roboot"
 )
 
-// use as callback parameter name such as ?callback=xxx
+// JSONPErrorMode decide how to response when the handler response error status.
+type JSONPErrorMode uint8
+
+const (
+	// JSONPErrorKeepStatus wrap the body and keep the status, browsers will trigger
+	// the onerror event of script tag instead of calling the callback.
+	JSONPErrorKeepStatus JSONPErrorMode = iota
+	// JSONPErrorStatusOK wrap the body and response 200, so the callback receives the error.
+	JSONPErrorStatusOK
+	// JSONPErrorPassthrough send the error response as is without wrapping.
+	JSONPErrorPassthrough
+)
+
+const jsonpContentType = "application/javascript; charset=utf-8"
+
+var (
+	ErrInvalidJSONPCallback = errors.New("invalid jsonp callback")
+
+	jsonpCallbackRegexp = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*(\.[a-zA-Z_$][a-zA-Z0-9_$]*)*$`)
+)
+
+// use as callback parameter name such as ?callback=xxx, it's a shortcut of JSONPOptions
+// with default options.
 type JSONP string
 
-var _ roboot.Filter = JSONP(0)
+var _ roboot.Filter = JSONP("")
+
+func (j JSONP) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	f := jsonpFilter{
+		param:     string(j),
+		maxLength: defaultJSONPCallbackLength,
+	}
+	f.Filter(ctx, chain)
+}
+
+// JSONPOptions wrap JSON responses of GET requests into callback invocation. Callback
+// names are validated to be javascript identifiers or dotted paths.
+type JSONPOptions struct {
+	Param     string   // default callback
+	Callbacks []string // allowed callback names, default allow all valid names
+	MaxLength int      // max length of callback name, default 128
+	ErrorMode JSONPErrorMode
+}
+
+const defaultJSONPCallbackLength = 128
+
+type jsonpFilter struct {
+	param     string
+	callbacks map[string]bool
+	maxLength int
+	errorMode JSONPErrorMode
+}
+
+func (j *JSONPOptions) ToFilter() roboot.Filter {
+	f := jsonpFilter{
+		param:     j.Param,
+		maxLength: j.MaxLength,
+		errorMode: j.ErrorMode,
+	}
+	if f.param == "" {
+		f.param = "callback"
+	}
+	if f.maxLength <= 0 {
+		f.maxLength = defaultJSONPCallbackLength
+	}
+	if len(j.Callbacks) > 0 {
+		f.callbacks = make(map[string]bool)
+		for _, c := range j.Callbacks {
+			f.callbacks[c] = true
+		}
+	}
+	return &f
+}
+
+func (f *jsonpFilter) validCallback(callback string) bool {
+	if f.callbacks != nil {
+		return f.callbacks[callback]
+	}
+	return len(callback) <= f.maxLength && jsonpCallbackRegexp.MatchString(callback)
+}
 
-type buffRespWriter struct {
+type jsonpWriter struct {
 	roboot.ResponseWriter
-	Buffer *bytes.Buffer
+	code int
+	buf  bytes.Buffer
 }
 
-func (w *buffRespWriter) Write(b []byte) (int, error) {
-	if w.Buffer == nil {
-		return w.ResponseWriter.Write(b)
+func (w *jsonpWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
 	}
-	return w.Buffer.Write(b)
 }
 
-func (j JSONP) Filter(ctx *roboot.Context, chain roboot.Handler) {
+func (w *jsonpWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.buf.Write(b)
+}
+
+func (w *jsonpWriter) StatusCode() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+func (w *jsonpWriter) BytesWritten() int64 {
+	return int64(w.buf.Len())
+}
+
+func (f *jsonpFilter) Filter(ctx *roboot.Context, chain roboot.Handler) {
 	if ctx.Req.Method != roboot.MethodGet {
 		chain.Handle(ctx)
 		return
 	}
 
-	callback := ctx.QueryValue(string(j))
+	callback := ctx.QueryValue(f.param)
 	if callback == "" {
 		chain.Handle(ctx)
 		return
 	}
-
-	buffer := bytes.NewBuffer(make([]byte, 0, 256))
-	bw := buffRespWriter{ // to avoid write header 200 first when write callback name
-		ResponseWriter: ctx.Resp,
-		Buffer:         buffer,
+	if !f.validCallback(callback) {
+		ctx.Error(ErrInvalidJSONPCallback, http.StatusBadRequest)
+		return
 	}
-	ctx.Resp = &bw
+
+	var (
+		resp = ctx.Resp
+		jw   = jsonpWriter{ // to avoid write header 200 first when write callback name
+			ResponseWriter: resp,
+		}
+	)
+	ctx.Resp = &jw
 	chain.Handle(ctx)
-	bw.Buffer = nil
+	ctx.Resp = resp
+
+	var (
+		header = resp.Header()
+		code   = jw.StatusCode()
+		isErr  = code >= http.StatusBadRequest
+		isJSON = strings.Contains(header.Get(roboot.HeaderContentType), "json")
+	)
+	if (isErr && f.errorMode == JSONPErrorPassthrough) || (jw.buf.Len() > 0 && !isJSON) || code == http.StatusNoContent || code == http.StatusNotModified {
+		resp.WriteHeader(code)
+		resp.Write(jw.buf.Bytes())
+		return
+	}
+	if isErr && f.errorMode == JSONPErrorStatusOK {
+		code = http.StatusOK
+	}
+	body := jw.buf.Bytes()
+	if len(body) == 0 {
+		body = []byte("null")
+	}
 
-	ctx.Resp.Write([]byte("("))
-	ctx.Resp.Write(bw.Buffer.Bytes())
-	ctx.Resp.Write([]byte(")"))
+	header.Del(roboot.HeaderContentLength)
+	header.Set(roboot.HeaderContentType, jsonpContentType)
+	header.Set(roboot.HeaderXContentTypeOptions, "nosniff")
+	resp.WriteHeader(code)
+	// the empty comment prevent the response from being interpreted as other content
+	resp.Write([]byte("/**/" + callback + "("))
+	resp.Write(body)
+	resp.Write([]byte(");"))
 }
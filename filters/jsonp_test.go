@@ -0,0 +1,48 @@
+package filters_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func TestJSONP(t *testing.T) {
+	handler := roboot.HandlerFunc(func(ctx *roboot.Context) {
+		if ctx.QueryValue("fail") != "" {
+			ctx.Resp.Header().Set(roboot.HeaderContentType, "application/json")
+			ctx.Resp.WriteHeader(http.StatusNotFound)
+			ctx.Resp.Write([]byte(`{"error":"not found"}`))
+			return
+		}
+		ctx.Resp.Header().Set(roboot.HeaderContentType, "application/json")
+		ctx.Resp.Write([]byte(`{"a":1}`))
+	})
+
+	tests := []struct {
+		filter roboot.Filter
+		query  string
+		status int
+		body   string
+	}{
+		{filters.JSONP("callback"), "", http.StatusOK, `{"a":1}`},
+		{filters.JSONP("callback"), "?callback=app.cb", http.StatusOK, `/**/app.cb({"a":1});`},
+		{filters.JSONP("callback"), "?callback=alert(1)", http.StatusBadRequest, ""},
+		{filters.JSONP("callback"), "?callback=cb&fail=1", http.StatusNotFound, `/**/cb({"error":"not found"});`},
+		{(&filters.JSONPOptions{ErrorMode: filters.JSONPErrorStatusOK}).ToFilter(), "?callback=cb&fail=1", http.StatusOK, `/**/cb({"error":"not found"});`},
+		{(&filters.JSONPOptions{ErrorMode: filters.JSONPErrorPassthrough}).ToFilter(), "?callback=cb&fail=1", http.StatusNotFound, `{"error":"not found"}`},
+		{(&filters.JSONPOptions{Callbacks: []string{"cb"}}).ToFilter(), "?callback=other", http.StatusBadRequest, ""},
+	}
+	for i, test := range tests {
+		s := newServer(t, "/", handler, test.filter)
+		req, _ := http.NewRequest("GET", "/"+test.query, nil)
+		resp := serve(s, req)
+		if resp.Code != test.status {
+			t.Errorf("%d: expect status %d, got %d", i, test.status, resp.Code)
+		}
+		if test.body != "" && resp.Body.String() != test.body {
+			t.Errorf("%d: expect body %s, got %s", i, test.body, resp.Body.String())
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package filters
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/cosiner/roboot"
+)
+
+// MethodOverride rewrite method of POST requests by the override header or form field,
+// it should be placed before handlers dispatch on method. Only urlencoded forms are
+// inspected to avoid parsing uploads.
+type MethodOverride struct {
+	Header       string // default X-HTTP-Method-Override
+	FormField    string // default _method
+	IgnoreHeader bool
+	IgnoreForm   bool
+	Methods      []string // allowed override methods, default PUT, PATCH and DELETE
+}
+
+type methodOverrideFilter struct {
+	header    string
+	formField string
+	methods   []string
+}
+
+func (m *MethodOverride) ToFilter() roboot.Filter {
+	f := methodOverrideFilter{
+		header:    m.Header,
+		formField: m.FormField,
+	}
+	if m.IgnoreHeader {
+		f.header = ""
+	} else if f.header == "" {
+		f.header = roboot.HeaderXHTTPMethodOverride
+	}
+	if m.IgnoreForm {
+		f.formField = ""
+	} else if f.formField == "" {
+		f.formField = "_method"
+	}
+	for _, method := range m.Methods {
+		f.methods = append(f.methods, strings.ToUpper(method))
+	}
+	if len(f.methods) == 0 {
+		f.methods = []string{roboot.MethodPut, roboot.MethodPatch, roboot.MethodDelete}
+	}
+	return &f
+}
+
+func (f *methodOverrideFilter) override(ctx *roboot.Context) string {
+	if f.header != "" {
+		if method := ctx.Req.Header.Get(f.header); method != "" {
+			return method
+		}
+	}
+	if f.formField != "" {
+		typ, _, _ := mime.ParseMediaType(ctx.Req.Header.Get(roboot.HeaderContentType))
+		if typ == "application/x-www-form-urlencoded" {
+			return ctx.BodyValue(f.formField)
+		}
+	}
+	return ""
+}
+
+func (f *methodOverrideFilter) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	if ctx.Req.Method == roboot.MethodPost {
+		if method := strings.ToUpper(strings.TrimSpace(f.override(ctx))); method != "" {
+			for _, m := range f.methods {
+				if m == method {
+					ctx.Req.Method = method
+					break
+				}
+			}
+		}
+	}
+	chain.Handle(ctx)
+}
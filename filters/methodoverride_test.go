@@ -0,0 +1,44 @@
+package filters_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+	"github.com/cosiner/roboot/handlers"
+)
+
+func TestMethodOverride(t *testing.T) {
+	s := newServer(t, "/", handlers.Methods{
+		roboot.MethodPost:   func(ctx *roboot.Context) { ctx.Resp.Write([]byte("post")) },
+		roboot.MethodDelete: func(ctx *roboot.Context) { ctx.Resp.Write([]byte("delete")) },
+	}, (&filters.MethodOverride{}).ToFilter())
+
+	tests := []struct {
+		method string
+		header string
+		form   string
+		expect string
+	}{
+		{"POST", "", "", "post"},
+		{"POST", "delete", "", "delete"},
+		{"POST", "", "_method=DELETE", "delete"},
+		{"POST", "CONNECT", "", "post"},
+		{"GET", "DELETE", "", ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, "/", strings.NewReader(test.form))
+		if test.header != "" {
+			req.Header.Set(roboot.HeaderXHTTPMethodOverride, test.header)
+		}
+		if test.form != "" {
+			req.Header.Set(roboot.HeaderContentType, "application/x-www-form-urlencoded")
+		}
+		resp := serve(s, req)
+		if resp.Body.String() != test.expect {
+			t.Errorf("%s %s %s: expect %q, got %q", test.method, test.header, test.form, test.expect, resp.Body.String())
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package filters
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cosiner/roboot"
+)
+
+const (
+	MetricCounter   = "counter"
+	MetricGauge     = "gauge"
+	MetricHistogram = "histogram"
+)
+
+type MetricSample struct {
+	Suffix string   // such as _bucket, _sum, _count for histogram
+	Labels []string // name and value pairs
+	Value  float64
+}
+
+type MetricFamily struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []MetricSample
+}
+
+type MetricsCollector interface {
+	CollectMetrics() []MetricFamily
+}
+
+var (
+	metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	metricsHelpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// MergeMetrics merge samples of families with same name into the first of them, the
+// exposition format requires samples of a family to be grouped under single HELP and TYPE.
+func MergeMetrics(families []MetricFamily) []MetricFamily {
+	var (
+		merged  = make([]MetricFamily, 0, len(families))
+		indexes = make(map[string]int, len(families))
+	)
+	for _, f := range families {
+		i, has := indexes[f.Name]
+		if !has {
+			indexes[f.Name] = len(merged)
+			f.Samples = f.Samples[:len(f.Samples):len(f.Samples)]
+			merged = append(merged, f)
+			continue
+		}
+		m := &merged[i]
+		if m.Help == "" {
+			m.Help = f.Help
+		}
+		if m.Type == "" {
+			m.Type = f.Type
+		}
+		m.Samples = append(m.Samples, f.Samples...)
+	}
+	return merged
+}
+
+// WriteMetrics write metric families in Prometheus text exposition format, families
+// with same name are merged.
+func WriteMetrics(w io.Writer, families []MetricFamily) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range MergeMetrics(families) {
+		if f.Help != "" {
+			bw.WriteString("# HELP " + f.Name + " " + metricsHelpEscaper.Replace(f.Help) + "\n")
+		}
+		if f.Type != "" {
+			bw.WriteString("# TYPE " + f.Name + " " + f.Type + "\n")
+		}
+		for _, s := range f.Samples {
+			bw.WriteString(f.Name + s.Suffix)
+			if len(s.Labels) > 1 {
+				bw.WriteByte('{')
+				for i := 0; i+1 < len(s.Labels); i += 2 {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(s.Labels[i] + `="` + metricsLabelEscaper.Replace(s.Labels[i+1]) + `"`)
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteString(" " + formatMetricValue(s.Value) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type requestMetricKey struct {
+	pattern string
+	method  string
+	status  int
+}
+
+type latencyHistogram struct {
+	counts []uint64 // cumulated when collecting
+	sum    float64
+	count  uint64
+}
+
+// Metrics record request counters, latency histograms and in-flight gauges labelled by
+// route pattern, method and status, the exposition handler is created by Handler.
+type Metrics struct {
+	namespace string
+	buckets   []float64
+
+	mu         sync.Mutex
+	requests   map[requestMetricKey]uint64
+	latencies  map[requestMetricKey]*latencyHistogram
+	inFlight   map[requestMetricKey]int64
+	collectors []MetricsCollector
+}
+
+var _ roboot.Filter = &Metrics{}
+
+// NewMetrics create metrics with namespace as metric name prefix, default "http", and
+// latency buckets in seconds, default DefaultLatencyBuckets.
+func NewMetrics(namespace string, buckets []float64) *Metrics {
+	if namespace == "" {
+		namespace = "http"
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{
+		namespace: namespace,
+		buckets:   buckets,
+		requests:  make(map[requestMetricKey]uint64),
+		latencies: make(map[requestMetricKey]*latencyHistogram),
+		inFlight:  make(map[requestMetricKey]int64),
+	}
+}
+
+// Register add collectors whose metrics are exposed with the request metrics.
+func (m *Metrics) Register(collectors ...MetricsCollector) {
+	m.mu.Lock()
+	m.collectors = append(m.collectors, collectors...)
+	m.mu.Unlock()
+}
+
+func (m *Metrics) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	key := requestMetricKey{
+		pattern: ctx.RoutePattern(),
+		method:  ctx.Req.Method,
+	}
+	m.mu.Lock()
+	m.inFlight[key]++
+	m.mu.Unlock()
+
+	begin := time.Now()
+	defer func() {
+		latency := time.Since(begin).Seconds()
+
+		m.mu.Lock()
+		m.inFlight[key]--
+		key.status = ctx.Resp.StatusCode()
+		m.requests[key]++
+		h := m.latencies[key]
+		if h == nil {
+			h = &latencyHistogram{counts: make([]uint64, len(m.buckets))}
+			m.latencies[key] = h
+		}
+		if i := sort.SearchFloat64s(m.buckets, latency); i < len(m.buckets) {
+			h.counts[i]++
+		}
+		h.sum += latency
+		h.count++
+		m.mu.Unlock()
+	}()
+
+	chain.Handle(ctx)
+}
+
+func sortedMetricKeys(keys []requestMetricKey) []requestMetricKey {
+	sort.Slice(keys, func(i, j int) bool {
+		ki, kj := keys[i], keys[j]
+		if ki.pattern != kj.pattern {
+			return ki.pattern < kj.pattern
+		}
+		if ki.method != kj.method {
+			return ki.method < kj.method
+		}
+		return ki.status < kj.status
+	})
+	return keys
+}
+
+func (m *Metrics) CollectMetrics() []MetricFamily {
+	m.mu.Lock()
+	families := m.requestMetrics()
+	collectors := m.collectors
+	m.mu.Unlock()
+
+	for _, c := range collectors {
+		families = append(families, c.CollectMetrics()...)
+	}
+	return MergeMetrics(families)
+}
+
+func (m *Metrics) requestMetrics() []MetricFamily {
+	var (
+		requests = MetricFamily{
+			Name: m.namespace + "_requests_total",
+			Help: "Total number of requests.",
+			Type: MetricCounter,
+		}
+		latencies = MetricFamily{
+			Name: m.namespace + "_request_duration_seconds",
+			Help: "Request latencies in seconds.",
+			Type: MetricHistogram,
+		}
+		inFlight = MetricFamily{
+			Name: m.namespace + "_requests_in_flight",
+			Help: "Number of requests being served.",
+			Type: MetricGauge,
+		}
+	)
+
+	keys := make([]requestMetricKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	for _, key := range sortedMetricKeys(keys) {
+		labels := []string{"pattern", key.pattern, "method", key.method, "status", strconv.Itoa(key.status)}
+		requests.Samples = append(requests.Samples, MetricSample{Labels: labels, Value: float64(m.requests[key])})
+
+		h := m.latencies[key]
+		var cumulated uint64
+		for i, bound := range m.buckets {
+			cumulated += h.counts[i]
+			latencies.Samples = append(latencies.Samples, MetricSample{
+				Suffix: "_bucket",
+				Labels: append(labels[:len(labels):len(labels)], "le", formatMetricValue(bound)),
+				Value:  float64(cumulated),
+			})
+		}
+		latencies.Samples = append(latencies.Samples,
+			MetricSample{Suffix: "_bucket", Labels: append(labels[:len(labels):len(labels)], "le", "+Inf"), Value: float64(h.count)},
+			MetricSample{Suffix: "_sum", Labels: labels, Value: h.sum},
+			MetricSample{Suffix: "_count", Labels: labels, Value: float64(h.count)},
+		)
+	}
+
+	keys = keys[:0]
+	for key := range m.inFlight {
+		keys = append(keys, key)
+	}
+	for _, key := range sortedMetricKeys(keys) {
+		inFlight.Samples = append(inFlight.Samples, MetricSample{
+			Labels: []string{"pattern", key.pattern, "method", key.method},
+			Value:  float64(m.inFlight[key]),
+		})
+	}
+
+	return []MetricFamily{requests, latencies, inFlight}
+}
+
+// Handler create the handler writes metrics in Prometheus text exposition format.
+func (m *Metrics) Handler() roboot.Handler {
+	return roboot.HandlerFunc(func(ctx *roboot.Context) {
+		ctx.Resp.Header().Set(roboot.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+		err := WriteMetrics(ctx.Resp, m.CollectMetrics())
+		if err != nil {
+			ctx.Env().Error.Log(ctx, roboot.ErrTypeEncode, err)
+		}
+	})
+}
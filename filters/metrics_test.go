@@ -0,0 +1,89 @@
+package filters_test
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	err := filters.WriteMetrics(&buf, []filters.MetricFamily{
+		{
+			Name:    "jobs_total",
+			Help:    "Total jobs,\nby queue.",
+			Type:    filters.MetricCounter,
+			Samples: []filters.MetricSample{{Labels: []string{"queue", "a\"b\\c\nd"}, Value: 2}},
+		},
+		{
+			Name:    "temperature",
+			Samples: []filters.MetricSample{{Value: math.Inf(1)}, {Value: 0.5}},
+		},
+		{
+			Name:    "jobs_total",
+			Help:    "Total jobs,\nby queue.",
+			Type:    filters.MetricCounter,
+			Samples: []filters.MetricSample{{Labels: []string{"queue", "e"}, Value: 3}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `# HELP jobs_total Total jobs,\nby queue.
+# TYPE jobs_total counter
+jobs_total{queue="a\"b\\c\nd"} 2
+jobs_total{queue="e"} 3
+temperature +Inf
+temperature 0.5
+`
+	if buf.String() != expect {
+		t.Errorf("expect:\n%s\ngot:\n%s", expect, buf.String())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := filters.NewMetrics("app", []float64{100, 0})
+	metrics.Register(
+		filters.NewCircuitBreaker(filters.CircuitBreakerConfig{Name: "a"}),
+		filters.NewCircuitBreaker(filters.CircuitBreakerConfig{Name: "b"}),
+	)
+	s := newServer(t, "/users/:id", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		ctx.Status(http.StatusCreated)
+	}), metrics)
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("POST", "/users/1", nil)
+		serve(s, req)
+	}
+
+	var buf bytes.Buffer
+	if err := filters.WriteMetrics(&buf, metrics.CollectMetrics()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	labels := `pattern="/users/:id",method="POST",status="201"`
+	for _, line := range []string{
+		`app_requests_total{` + labels + `} 2`,
+		`app_request_duration_seconds_bucket{` + labels + `,le="0"} 0`,
+		`app_request_duration_seconds_bucket{` + labels + `,le="100"} 2`,
+		`app_request_duration_seconds_bucket{` + labels + `,le="+Inf"} 2`,
+		`app_request_duration_seconds_count{` + labels + `} 2`,
+		`app_requests_in_flight{pattern="/users/:id",method="POST"} 0`,
+		`circuit_breaker_state{breaker="a"} 0`,
+		`circuit_breaker_state{breaker="b"} 0`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("metrics should contain %s:\n%s", line, out)
+		}
+	}
+	if n := strings.Count(out, "# TYPE circuit_breaker_state "); n != 1 {
+		t.Errorf("expect single TYPE line of merged family, got %d", n)
+	}
+	if strings.Index(out, `le="0"`) > strings.Index(out, `le="100"`) {
+		t.Error("expect buckets in ascending order")
+	}
+}
@@ -0,0 +1,278 @@
+package filters
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cosiner/roboot"
+)
+
+type RateLimitAlgorithm uint8
+
+const (
+	TokenBucket RateLimitAlgorithm = iota
+	SlidingWindow
+)
+
+type Rate struct {
+	Limit  int // requests per period
+	Period time.Duration
+	Burst  int // token bucket capacity, default to Limit
+}
+
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // duration until the quota is fully restored
+	RetryAfter time.Duration // only meaningful if not allowed
+}
+
+type RateLimitStore interface {
+	Take(key string, algorithm RateLimitAlgorithm, rate Rate, now time.Time) RateLimitResult
+}
+
+type RateLimitKeyFunc func(ctx *roboot.Context) string
+
+func RateLimitByIP(ctx *roboot.Context) string {
+	return ctx.ClientIP()
+}
+
+// RateLimitByContextValue use the context value set by authentication filters as the key,
+// requests without the value are limited by client ip.
+func RateLimitByContextValue(name string) RateLimitKeyFunc {
+	return func(ctx *roboot.Context) string {
+		val := ctx.ContextValue(name)
+		if val == nil {
+			return "ip:" + RateLimitByIP(ctx)
+		}
+		return "principal:" + fmt.Sprint(val)
+	}
+}
+
+type RateLimit struct {
+	Algorithm RateLimitAlgorithm
+	Rate      Rate
+	// Scope is prepended to keys, filters attached to different routes should use
+	// different scopes if they shared the same store.
+	Scope string
+	Key   RateLimitKeyFunc // default RateLimitByIP, empty key means no limit
+	Store RateLimitStore   // default NewMemoryRateLimitStore(0, 0)
+}
+
+type rateLimitFilter struct {
+	algorithm RateLimitAlgorithm
+	rate      Rate
+	scope     string
+	key       RateLimitKeyFunc
+	store     RateLimitStore
+}
+
+var errRateLimited = errors.New("rate limit exceeded")
+
+func (r *RateLimit) ToFilter() roboot.Filter {
+	if r.Rate.Limit <= 0 || r.Rate.Period <= 0 {
+		panic("rate limit and period should be positive")
+	}
+	f := rateLimitFilter{
+		algorithm: r.Algorithm,
+		rate:      r.Rate,
+		scope:     r.Scope,
+		key:       r.Key,
+		store:     r.Store,
+	}
+	if f.rate.Burst <= 0 {
+		f.rate.Burst = f.rate.Limit
+	}
+	if f.key == nil {
+		f.key = RateLimitByIP
+	}
+	if f.store == nil {
+		f.store = NewMemoryRateLimitStore(0, 0)
+	}
+	return &f
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func (f *rateLimitFilter) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	key := f.key(ctx)
+	if key == "" {
+		chain.Handle(ctx)
+		return
+	}
+
+	result := f.store.Take(f.scope+key, f.algorithm, f.rate, time.Now())
+	headers := ctx.Resp.Header()
+	headers.Set(roboot.HeaderRateLimitLimit, strconv.Itoa(result.Limit))
+	headers.Set(roboot.HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+	headers.Set(roboot.HeaderRateLimitReset, ceilSeconds(result.Reset))
+	if !result.Allowed {
+		headers.Set(roboot.HeaderRetryAfter, ceilSeconds(result.RetryAfter))
+		ctx.Error(errRateLimited, http.StatusTooManyRequests)
+		return
+	}
+	chain.Handle(ctx)
+}
+
+type rateLimitEntry struct {
+	expire time.Time // the state is same as a fresh one after expire time
+
+	// token bucket
+	tokens float64
+	last   time.Time
+
+	// sliding window
+	windowStart time.Time
+	prevCount   int
+	currCount   int
+}
+
+type rateLimitShard struct {
+	mu        sync.Mutex
+	entries   map[string]*rateLimitEntry
+	lastSweep time.Time
+}
+
+type memoryRateLimitStore struct {
+	sweepInterval time.Duration
+	shards        []rateLimitShard
+}
+
+// NewMemoryRateLimitStore create a in-memory store, keys are distributed to shards to
+// reduce lock contention, and each shard evicts idle keys every sweepInterval.
+func NewMemoryRateLimitStore(shards int, sweepInterval time.Duration) RateLimitStore {
+	const (
+		defaultShards        = 32
+		defaultSweepInterval = time.Minute
+	)
+	if shards <= 0 {
+		shards = defaultShards
+	}
+	if sweepInterval <= 0 {
+		sweepInterval = defaultSweepInterval
+	}
+	s := &memoryRateLimitStore{
+		sweepInterval: sweepInterval,
+		shards:        make([]rateLimitShard, shards),
+	}
+	for i := range s.shards {
+		s.shards[i].entries = make(map[string]*rateLimitEntry)
+	}
+	return s
+}
+
+func (s *memoryRateLimitStore) shard(key string) *rateLimitShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+func (s *memoryRateLimitStore) Take(key string, algorithm RateLimitAlgorithm, rate Rate, now time.Time) RateLimitResult {
+	shard := s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if now.Sub(shard.lastSweep) >= s.sweepInterval {
+		for k, e := range shard.entries {
+			if now.After(e.expire) {
+				delete(shard.entries, k)
+			}
+		}
+		shard.lastSweep = now
+	}
+
+	entry, has := shard.entries[key]
+	if !has {
+		entry = &rateLimitEntry{}
+		shard.entries[key] = entry
+	}
+	switch algorithm {
+	case SlidingWindow:
+		return entry.slidingWindow(rate, now)
+	default:
+		return entry.tokenBucket(rate, now)
+	}
+}
+
+func (e *rateLimitEntry) tokenBucket(rate Rate, now time.Time) RateLimitResult {
+	var (
+		capacity = float64(rate.Burst)
+		perSec   = float64(rate.Limit) / rate.Period.Seconds()
+	)
+	if capacity <= 0 {
+		capacity = float64(rate.Limit)
+	}
+	if e.last.IsZero() {
+		e.tokens = capacity
+	} else if elapsed := now.Sub(e.last).Seconds(); elapsed > 0 {
+		e.tokens = math.Min(capacity, e.tokens+elapsed*perSec)
+	}
+	e.last = now
+
+	result := RateLimitResult{Limit: int(capacity)}
+	if e.tokens >= 1 {
+		e.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsDuration((1 - e.tokens) / perSec)
+	}
+	result.Remaining = int(e.tokens)
+	result.Reset = secondsDuration((capacity - e.tokens) / perSec)
+	e.expire = now.Add(result.Reset)
+	return result
+}
+
+func (e *rateLimitEntry) slidingWindow(rate Rate, now time.Time) RateLimitResult {
+	period := rate.Period
+	start := now.Truncate(period)
+	if !e.windowStart.Equal(start) {
+		if e.windowStart.Add(period).Equal(start) {
+			e.prevCount = e.currCount
+		} else {
+			e.prevCount = 0
+		}
+		e.currCount = 0
+		e.windowStart = start
+	}
+
+	var (
+		elapsed   = now.Sub(start)
+		weight    = 1 - float64(elapsed)/float64(period)
+		limit     = float64(rate.Limit)
+		estimated = float64(e.prevCount)*weight + float64(e.currCount)
+	)
+	result := RateLimitResult{
+		Limit: rate.Limit,
+		Reset: period - elapsed,
+	}
+	if estimated+1 <= limit {
+		e.currCount++
+		estimated++
+		result.Allowed = true
+	} else {
+		// wait until the weighted count of previous window decreased enough,
+		// or the next window if current window is already full.
+		curr := float64(e.currCount)
+		if curr <= limit-1 && e.prevCount > 0 {
+			result.RetryAfter = time.Duration(float64(period)*(1-(limit-1-curr)/float64(e.prevCount))) - elapsed
+		} else {
+			result.RetryAfter = period - elapsed + time.Duration(float64(period)*(1-(limit-1)/curr))
+		}
+	}
+	result.Remaining = int(math.Max(0, limit-math.Ceil(estimated)))
+	e.expire = start.Add(2 * period)
+	return result
+}
+
+func secondsDuration(secs float64) time.Duration {
+	return time.Duration(secs * float64(time.Second))
+}
@@ -0,0 +1,89 @@
+package filters_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/codec"
+	"github.com/cosiner/roboot/filters"
+	"github.com/cosiner/roboot/router"
+)
+
+type errorHandler struct{}
+
+func (errorHandler) Log(ctx *roboot.Context, errType roboot.ErrType, err error) {}
+
+func (errorHandler) Handle(ctx *roboot.Context, callerDepth int, status int, err error) {
+	ctx.Status(status)
+}
+
+func newServer(t *testing.T, path string, handler roboot.Handler, filters ...roboot.Filter) roboot.Server {
+	s := roboot.NewServer(roboot.Env{Codec: codec.JSON, Error: errorHandler{}}, router.New())
+	r := s.Router("")
+	if err := r.Handle(path, handler); err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) > 0 {
+		if err := r.Filter(path, filters...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func serve(s roboot.Server, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestRateLimitFilter(t *testing.T) {
+	limit := filters.RateLimit{
+		Rate: filters.Rate{Limit: 2, Period: time.Minute},
+	}
+	s := newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {}), limit.ToFilter())
+
+	for i, expect := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		resp := serve(s, req)
+		if resp.Code != expect {
+			t.Fatalf("request %d: expect status %d, got %d", i, expect, resp.Code)
+		}
+		if i == 2 && resp.Header().Get(roboot.HeaderRetryAfter) == "" {
+			t.Fatal("expect Retry-After header")
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	if resp := serve(s, req); resp.Code != http.StatusOK {
+		t.Fatal("keys should be limited separately")
+	}
+}
+
+func TestRateLimitAlgorithms(t *testing.T) {
+	var (
+		store = filters.NewMemoryRateLimitStore(1, time.Minute)
+		rate  = filters.Rate{Limit: 10, Period: time.Second}
+		now   = time.Unix(1000, 0)
+	)
+	for _, alg := range []filters.RateLimitAlgorithm{filters.TokenBucket, filters.SlidingWindow} {
+		key := string(rune('a' + alg))
+		for i := 0; i < rate.Limit; i++ {
+			if !store.Take(key, alg, rate, now).Allowed {
+				t.Fatalf("algorithm %d: request %d should be allowed", alg, i)
+			}
+		}
+		result := store.Take(key, alg, rate, now)
+		if result.Allowed || result.RetryAfter <= 0 {
+			t.Fatalf("algorithm %d: request should be limited", alg)
+		}
+		if !store.Take(key, alg, rate, now.Add(result.RetryAfter+time.Millisecond)).Allowed {
+			t.Fatalf("algorithm %d: request should be allowed after %s", alg, result.RetryAfter)
+		}
+	}
+}
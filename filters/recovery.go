@@ -3,44 +3,68 @@ package filters
 import (
 	"fmt"
 	"net/http"
-	"reflect"
-	"runtime"
-	"unsafe"
+	"runtime/debug"
 
 	"github.com/cosiner/roboot"
 )
 
-func unsafeToString(b []byte) (s string) {
-	pbytes := (*reflect.SliceHeader)(unsafe.Pointer(&b))
-	pstring := (*reflect.StringHeader)(unsafe.Pointer(&s))
-
-	pstring.Data = pbytes.Data
-	pstring.Len = pbytes.Len
+// PanicInfo describe a recovered panic, it's passed to ErrorHandler.Handle as the error.
+type PanicInfo struct {
+	Value     interface{}
+	Stack     []byte
+	Route     string
+	RequestID string
+}
 
-	return
+func (p *PanicInfo) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
 }
 
 type Recovery struct {
-	Bufsize int
+	Bufsize  int                                        // Deprecated: the full stack is always recorded
+	Status   int                                        // default 500
+	Reporter func(ctx *roboot.Context, info *PanicInfo) // report panics to external services
 }
 
 var _ roboot.Filter = &Recovery{}
 
+func headerWritten(w roboot.ResponseWriter) bool {
+	if hw, ok := w.(interface{ HeaderWritten() bool }); ok {
+		return hw.HeaderWritten()
+	}
+	return w.BytesWritten() > 0
+}
+
 func (r Recovery) Filter(ctx *roboot.Context, chain roboot.Handler) {
-	const defaultBufsize = 4096
+	resp := ctx.Resp
 	defer func() {
-		if err := recover(); err != nil {
-			bufsize := r.Bufsize
-			if bufsize <= 0 {
-				bufsize = defaultBufsize
-			}
-			buf := make([]byte, bufsize)
-			n := runtime.Stack(buf, false)
-			buf = buf[:n]
-
-			ctx.Status(http.StatusInternalServerError)
-			ctx.Env().Error.Log(ctx, roboot.ErrTypePanic, fmt.Errorf("panic: %v, stack: %s", err, unsafeToString(buf)))
+		err := recover()
+		if err == nil {
+			return
+		}
+		if err == http.ErrAbortHandler {
+			panic(err)
+		}
+
+		ctx.Resp = resp
+		info := PanicInfo{
+			Value:     err,
+			Stack:     debug.Stack(),
+			Route:     ctx.RoutePattern(),
+			RequestID: ctx.RequestID(),
+		}
+		if r.Reporter != nil {
+			r.Reporter(ctx, &info)
+		}
+		ctx.Env().Error.Log(ctx, roboot.ErrTypePanic, fmt.Errorf("panic: %v, stack: %s", err, info.Stack))
+		if headerWritten(resp) {
+			return
+		}
+		status := r.Status
+		if status <= 0 {
+			status = http.StatusInternalServerError
 		}
+		ctx.Env().Error.Handle(ctx, 0, status, &info)
 	}()
 
 	chain.Handle(ctx)
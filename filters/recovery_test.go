@@ -0,0 +1,50 @@
+package filters_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func TestRecovery(t *testing.T) {
+	var info *filters.PanicInfo
+	recovery := filters.Recovery{
+		Reporter: func(ctx *roboot.Context, i *filters.PanicInfo) {
+			info = i
+		},
+	}
+	s := newServer(t, "/:partial", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		if ctx.ParamValue("partial") == "partial" {
+			ctx.Resp.Write([]byte("partial"))
+		}
+		panic("boom")
+	}), recovery)
+
+	req, _ := http.NewRequest("GET", "/full", nil)
+	resp := serve(s, req)
+	if resp.Code != http.StatusInternalServerError {
+		t.Errorf("expect status 500, got %d", resp.Code)
+	}
+	if info == nil || info.Value != "boom" || info.Route == "" || len(info.Stack) == 0 {
+		t.Fatalf("unexpected panic info: %+v", info)
+	}
+
+	req, _ = http.NewRequest("GET", "/partial", nil)
+	resp = serve(s, req)
+	if resp.Code != http.StatusOK || resp.Body.String() != "partial" {
+		t.Errorf("response should not be overwritten: %d %s", resp.Code, resp.Body.String())
+	}
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("expect ErrAbortHandler, got %v", err)
+		}
+	}()
+	s = newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		panic(http.ErrAbortHandler)
+	}), recovery)
+	req, _ = http.NewRequest("GET", "/", nil)
+	serve(s, req)
+}
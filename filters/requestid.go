@@ -0,0 +1,86 @@
+package filters
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/cosiner/roboot"
+)
+
+var requestIDSeq uint64
+
+// NewRequestID generate a random 128 bits hex id.
+func NewRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// fallback to time and sequence, unique in current process
+		now := uint64(time.Now().UnixNano())
+		seq := atomic.AddUint64(&requestIDSeq, 1)
+		for i := 0; i < 8; i++ {
+			b[i] = byte(now >> (8 * uint(i)))
+			b[8+i] = byte(seq >> (8 * uint(i)))
+		}
+	}
+	return hex.EncodeToString(b[:])
+}
+
+type RequestID struct {
+	Header    string        // default X-Request-ID
+	Generate  func() string // default NewRequestID
+	IgnoreReq bool          // always generate new id instead of reading from request
+	MaxLength int           // ids from request exceeds the length are replaced, default 128
+}
+
+type requestIDFilter struct {
+	header    string
+	generate  func() string
+	ignoreReq bool
+	maxLength int
+}
+
+func (r *RequestID) ToFilter() roboot.Filter {
+	const defaultMaxLength = 128
+	f := requestIDFilter{
+		header:    r.Header,
+		generate:  r.Generate,
+		ignoreReq: r.IgnoreReq,
+		maxLength: r.MaxLength,
+	}
+	if f.header == "" {
+		f.header = roboot.HeaderXRequestID
+	}
+	if f.generate == nil {
+		f.generate = NewRequestID
+	}
+	if f.maxLength <= 0 {
+		f.maxLength = defaultMaxLength
+	}
+	return &f
+}
+
+func (f *requestIDFilter) isValid(id string) bool {
+	if id == "" || len(id) > f.maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' { // printable ascii only, the id is written to logs and headers
+			return false
+		}
+	}
+	return true
+}
+
+func (f *requestIDFilter) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	var id string
+	if !f.ignoreReq {
+		id = ctx.Req.Header.Get(f.header)
+	}
+	if !f.isValid(id) {
+		id = f.generate()
+	}
+	ctx.SetRequestID(id)
+	ctx.Resp.Header().Set(f.header, id)
+	chain.Handle(ctx)
+}
@@ -0,0 +1,72 @@
+package filters_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/codec"
+	"github.com/cosiner/roboot/filters"
+	"github.com/cosiner/roboot/router"
+)
+
+type requestIDErrorHandler struct {
+	errorHandler
+	logged *string
+}
+
+func (e requestIDErrorHandler) Log(ctx *roboot.Context, errType roboot.ErrType, err error) {
+	*e.logged = ctx.RequestID()
+}
+
+func TestRequestID(t *testing.T) {
+	var handled, logged string
+	s := roboot.NewServer(roboot.Env{Codec: codec.JSON, Error: requestIDErrorHandler{logged: &logged}}, router.New())
+	err := s.Router("").Handle("/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		handled = ctx.RequestID()
+		ctx.QueryValue("q") // malformed query is logged by error handler
+	}), (&filters.RequestID{MaxLength: 8, Generate: func() string { return "generated" }}).ToFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		incoming string
+		expect   string
+	}{
+		{"", "generated"},
+		{"abc-123", "abc-123"},
+		{"bad id", "generated"},
+		{"bad\x7fid", "generated"},
+		{strings.Repeat("a", 9), "generated"},
+	}
+	for _, test := range tests {
+		handled, logged = "", ""
+		req, _ := http.NewRequest("GET", "/?q=%zz", nil)
+		if test.incoming != "" {
+			req.Header.Set(roboot.HeaderXRequestID, test.incoming)
+		}
+		resp := serve(s, req)
+		if handled != test.expect {
+			t.Errorf("%q: expect request id %s, got %s", test.incoming, test.expect, handled)
+		}
+		if got := resp.Header().Get(roboot.HeaderXRequestID); got != test.expect {
+			t.Errorf("%q: expect response id %s, got %s", test.incoming, test.expect, got)
+		}
+		if logged != test.expect {
+			t.Errorf("%q: expect logged id %s, got %s", test.incoming, test.expect, logged)
+		}
+	}
+
+	s = newServer(t, "/", roboot.HandlerFunc(func(ctx *roboot.Context) {}), (&filters.RequestID{}).ToFilter())
+	ids := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		id := serve(s, req).Header().Get(roboot.HeaderXRequestID)
+		if len(id) != 32 || ids[id] {
+			t.Errorf("expect unique 128 bits hex id, got %s", id)
+		}
+		ids[id] = true
+	}
+}
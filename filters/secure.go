@@ -0,0 +1,111 @@
+package filters
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cosiner/roboot"
+)
+
+// CSPNoncePlaceholder in ContentSecurityPolicy is replaced by per-request nonce.
+const CSPNoncePlaceholder = "{nonce}"
+
+// Secure set security headers for responses, empty fields are not sent.
+type Secure struct {
+	HSTSMaxAge            time.Duration // only sent for https requests
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// nonce is stored as context value roboot.ContextValueCSPNonce, and can be accessed
+	// by CSPNonce, or "cspNonce" function in templates of renderer.HTML.
+	ContentSecurityPolicy string
+	CSPReportOnly         bool
+
+	FrameOptions              string // DENY or SAMEORIGIN
+	ContentTypeNosniff        bool
+	ReferrerPolicy            string
+	PermissionsPolicy         string
+	CrossOriginOpenerPolicy   string
+	CrossOriginEmbedderPolicy string
+}
+
+type secureFilter struct {
+	hsts         string
+	csp          string
+	cspHeader    string
+	cspNonce     bool
+	staticHeader [][2]string
+}
+
+func (s *Secure) ToFilter() roboot.Filter {
+	var f secureFilter
+	if s.HSTSMaxAge > 0 {
+		f.hsts = "max-age=" + strconv.FormatInt(int64(s.HSTSMaxAge/time.Second), 10)
+		if s.HSTSIncludeSubdomains {
+			f.hsts += "; includeSubDomains"
+		}
+		if s.HSTSPreload {
+			f.hsts += "; preload"
+		}
+	}
+
+	f.csp = s.ContentSecurityPolicy
+	f.cspNonce = strings.Contains(f.csp, CSPNoncePlaceholder)
+	f.cspHeader = roboot.HeaderContentSecurityPolicy
+	if s.CSPReportOnly {
+		f.cspHeader = roboot.HeaderContentSecurityPolicyReportOnly
+	}
+
+	for _, h := range [][2]string{
+		{roboot.HeaderXFrameOptions, s.FrameOptions},
+		{roboot.HeaderReferrerPolicy, s.ReferrerPolicy},
+		{roboot.HeaderPermissionsPolicy, s.PermissionsPolicy},
+		{roboot.HeaderCrossOriginOpenerPolicy, s.CrossOriginOpenerPolicy},
+		{roboot.HeaderCrossOriginEmbedderPolicy, s.CrossOriginEmbedderPolicy},
+	} {
+		if h[1] != "" {
+			f.staticHeader = append(f.staticHeader, h)
+		}
+	}
+	if s.ContentTypeNosniff {
+		f.staticHeader = append(f.staticHeader, [2]string{roboot.HeaderXContentTypeOptions, "nosniff"})
+	}
+	return &f
+}
+
+func newCSPNonce() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// CSPNonce return the nonce of current request, it's empty if there is no nonce.
+func CSPNonce(ctx *roboot.Context) string {
+	nonce, _ := ctx.ContextValue(roboot.ContextValueCSPNonce).(string)
+	return nonce
+}
+
+func (f *secureFilter) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	headers := ctx.Resp.Header()
+	for _, h := range f.staticHeader {
+		headers.Set(h[0], h[1])
+	}
+	if f.hsts != "" && ctx.Scheme() == "https" {
+		headers.Set(roboot.HeaderStrictTransportSecurity, f.hsts)
+	}
+	if f.csp != "" {
+		csp := f.csp
+		if f.cspNonce {
+			nonce := newCSPNonce()
+			ctx.SetContextValue(roboot.ContextValueCSPNonce, nonce)
+			csp = strings.Replace(csp, CSPNoncePlaceholder, nonce, -1)
+		}
+		headers.Set(f.cspHeader, csp)
+	}
+	chain.Handle(ctx)
+}
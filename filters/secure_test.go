@@ -0,0 +1,67 @@
+package filters_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func TestSecure(t *testing.T) {
+	var nonce string
+	handler := roboot.HandlerFunc(func(ctx *roboot.Context) {
+		nonce = filters.CSPNonce(ctx)
+	})
+	secure := filters.Secure{
+		HSTSMaxAge:            time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "script-src 'nonce-{nonce}'",
+		FrameOptions:          "DENY",
+		ContentTypeNosniff:    true,
+	}
+	s := newServer(t, "/", handler, secure.ToFilter())
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	resp := serve(s, req)
+	if hsts := resp.Header().Get(roboot.HeaderStrictTransportSecurity); hsts != "" {
+		t.Errorf("expect no HSTS for http, got %s", hsts)
+	}
+	if resp.Header().Get(roboot.HeaderXFrameOptions) != "DENY" || resp.Header().Get(roboot.HeaderXContentTypeOptions) != "nosniff" {
+		t.Errorf("expect static headers, got %v", resp.Header())
+	}
+	if nonce == "" || strings.Contains(nonce, "{") {
+		t.Fatalf("expect generated nonce, got %q", nonce)
+	}
+	if csp := resp.Header().Get(roboot.HeaderContentSecurityPolicy); csp != "script-src 'nonce-"+nonce+"'" {
+		t.Errorf("expect nonce substituted, got %s", csp)
+	}
+	first := nonce
+
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	resp = serve(s, req)
+	if hsts := resp.Header().Get(roboot.HeaderStrictTransportSecurity); hsts != "max-age=3600; includeSubDomains" {
+		t.Errorf("expect HSTS for https, got %s", hsts)
+	}
+	if nonce == first {
+		t.Error("expect different nonce for each request")
+	}
+
+	secure = filters.Secure{ContentSecurityPolicy: "default-src 'self'", CSPReportOnly: true}
+	s = newServer(t, "/", handler, secure.ToFilter())
+	req, _ = http.NewRequest("GET", "/", nil)
+	resp = serve(s, req)
+	if csp := resp.Header().Get(roboot.HeaderContentSecurityPolicyReportOnly); csp != "default-src 'self'" {
+		t.Errorf("expect report only policy, got %s", csp)
+	}
+	if csp := resp.Header().Get(roboot.HeaderContentSecurityPolicy); csp != "" {
+		t.Errorf("expect no enforced policy, got %s", csp)
+	}
+	if nonce != "" {
+		t.Errorf("expect no nonce without placeholder, got %s", nonce)
+	}
+}
@@ -0,0 +1,143 @@
+package filters
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cosiner/roboot"
+)
+
+var ErrHandlerTimeout = errors.New("handler timeout")
+
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+var _ roboot.ResponseWriter = &timeoutWriter{}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	if !w.timedOut && w.code == 0 {
+		w.code = code
+	}
+	w.mu.Unlock()
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.buf.Write(b)
+}
+
+func (w *timeoutWriter) StatusCode() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+func (w *timeoutWriter) BytesWritten() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return int64(w.buf.Len())
+}
+
+// Timeout bound the execution of remaining chain, the request's context is canceled when
+// timeout, and error is written through Env.Error. Responses are buffered until the chain
+// completed, writes after timeout are discarded.
+type Timeout struct {
+	Timeout time.Duration
+	Status  int // http.StatusServiceUnavailable or http.StatusGatewayTimeout, default 503
+}
+
+type timeoutFilter struct {
+	timeout time.Duration
+	status  int
+}
+
+func (t *Timeout) ToFilter() roboot.Filter {
+	if t.Timeout <= 0 {
+		panic("timeout should be positive")
+	}
+	f := timeoutFilter{
+		timeout: t.Timeout,
+		status:  t.Status,
+	}
+	if f.status == 0 {
+		f.status = http.StatusServiceUnavailable
+	}
+	return &f
+}
+
+func (f *timeoutFilter) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	reqCtx, cancel := context.WithTimeout(ctx.Req.Context(), f.timeout)
+	defer cancel()
+
+	var (
+		tw = &timeoutWriter{
+			header: ctx.Resp.Header().Clone(),
+		}
+		hctx     = ctx.Clone() // the handler goroutine use it's own context
+		done     = make(chan struct{})
+		panicked = make(chan interface{}, 1)
+	)
+	hctx.Req = ctx.Req.WithContext(reqCtx)
+	hctx.Resp = tw
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicked <- p
+			}
+		}()
+		chain.Handle(hctx)
+		close(done)
+	}()
+
+	select {
+	case p := <-panicked:
+		panic(p)
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		header := ctx.Resp.Header()
+		for k := range header {
+			if _, has := tw.header[k]; !has {
+				delete(header, k)
+			}
+		}
+		for k, v := range tw.header {
+			header[k] = v
+		}
+		if tw.code != 0 {
+			ctx.Status(tw.code)
+		}
+		ctx.Resp.Write(tw.buf.Bytes())
+	case <-reqCtx.Done():
+		tw.mu.Lock()
+		tw.timedOut = true
+		tw.mu.Unlock()
+		if reqCtx.Err() == context.DeadlineExceeded {
+			ctx.Error(ErrHandlerTimeout, f.status)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package filters_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func TestTimeout(t *testing.T) {
+	var (
+		lateWrite  = make(chan error, 1)
+		lateErr    error
+		innerValue interface{} // value set by the timed out handler, seen by outer filter
+		outerValue interface{} // value set by outer filter, seen by handler
+		timeout    = (&filters.Timeout{Timeout: 50 * time.Millisecond}).ToFilter()
+		outer      = roboot.FilterFunc(func(ctx *roboot.Context, chain roboot.Handler) {
+			ctx.SetContextValue("outer", "before")
+			chain.Handle(ctx)
+			// races with the handler goroutine if they share the context
+			ctx.SetContextValue("outer", "after")
+			if ctx.ParamValue("action") == "slow" {
+				lateErr = <-lateWrite
+				innerValue = ctx.ContextValue("inner")
+			}
+		})
+	)
+	s := newServer(t, "/:action", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		switch ctx.ParamValue("action") {
+		case "ok":
+			ctx.Resp.Header().Set("X-Handler", "ok")
+			ctx.Resp.WriteHeader(http.StatusCreated)
+			ctx.Resp.Write([]byte("created"))
+		case "slow":
+			<-ctx.Req.Context().Done()
+			time.Sleep(10 * time.Millisecond)
+			outerValue = ctx.ContextValue("outer")
+			ctx.SetContextValue("inner", "late")
+			_, err := ctx.Resp.Write([]byte("late"))
+			lateWrite <- err
+		case "panic":
+			panic("boom")
+		}
+	}), outer, timeout)
+
+	req, _ := http.NewRequest("GET", "/ok", nil)
+	resp := serve(s, req)
+	if resp.Code != http.StatusCreated || resp.Body.String() != "created" || resp.Header().Get("X-Handler") != "ok" {
+		t.Errorf("unexpected response: %d %s %v", resp.Code, resp.Body.String(), resp.Header())
+	}
+
+	req, _ = http.NewRequest("GET", "/slow", nil)
+	resp = serve(s, req)
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("expect status 503, got %d", resp.Code)
+	}
+	if lateErr == nil {
+		t.Error("write after timeout should fail")
+	}
+	if outerValue != "before" {
+		t.Errorf("handler should see values set before it, got %v", outerValue)
+	}
+	if innerValue != nil {
+		t.Errorf("timed out handler should not change context of caller, got %v", innerValue)
+	}
+	if resp.Body.String() == "late" {
+		t.Error("write after timeout should be discarded")
+	}
+
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Errorf("expect panic boom, got %v", p)
+		}
+	}()
+	req, _ = http.NewRequest("GET", "/panic", nil)
+	serve(s, req)
+}
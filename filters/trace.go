@@ -0,0 +1,297 @@
+package filters
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cosiner/roboot"
+)
+
+const (
+	traceVersion     = "00"
+	traceFlagSampled = 0x01
+)
+
+type Span struct {
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_id,omitempty"`
+	Name       string            `json:"name"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+type SpanExporter interface {
+	Export(span *Span)
+}
+
+type MemorySpanExporter struct {
+	mu    sync.Mutex
+	spans []Span
+}
+
+func (m *MemorySpanExporter) Export(span *Span) {
+	m.mu.Lock()
+	m.spans = append(m.spans, *span)
+	m.mu.Unlock()
+}
+
+// Spans return finished spans, child spans are always ahead of it's parent.
+func (m *MemorySpanExporter) Spans() []Span {
+	m.mu.Lock()
+	spans := make([]Span, len(m.spans))
+	copy(spans, m.spans)
+	m.mu.Unlock()
+	return spans
+}
+
+func (m *MemorySpanExporter) Reset() {
+	m.mu.Lock()
+	m.spans = nil
+	m.mu.Unlock()
+}
+
+// JSONFileSpanExporter write spans to file as JSON lines.
+type JSONFileSpanExporter struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+	err  error
+}
+
+func NewJSONFileSpanExporter(path string) (*JSONFileSpanExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONFileSpanExporter{
+		file: file,
+		enc:  json.NewEncoder(file),
+	}, nil
+}
+
+func (j *JSONFileSpanExporter) Export(span *Span) {
+	j.mu.Lock()
+	if j.err == nil {
+		j.err = j.enc.Encode(span)
+	}
+	j.mu.Unlock()
+}
+
+// Close close the file and return the first error occurred.
+func (j *JSONFileSpanExporter) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.file.Close()
+	if j.err != nil {
+		return j.err
+	}
+	return err
+}
+
+type TraceContext struct {
+	TraceID  string
+	ParentID string
+	Flags    byte
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZeroHex(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
+
+// ParseTraceParent parse the traceparent header defined by W3C Trace Context.
+func ParseTraceParent(header string) (TraceContext, bool) {
+	var tc TraceContext
+	header = strings.TrimSpace(header)
+	parts := strings.Split(header, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || !isLowerHex(parts[0]) || parts[0] == "ff" {
+		return tc, false
+	}
+	if parts[0] == traceVersion && len(parts) != 4 { // future versions may append fields
+		return tc, false
+	}
+	traceID, parentID, flags := parts[1], parts[2], parts[3]
+	if len(traceID) != 32 || !isLowerHex(traceID) || isZeroHex(traceID) ||
+		len(parentID) != 16 || !isLowerHex(parentID) || isZeroHex(parentID) ||
+		len(flags) != 2 || !isLowerHex(flags) {
+		return tc, false
+	}
+	f, _ := strconv.ParseUint(flags, 16, 8)
+	tc.TraceID = traceID
+	tc.ParentID = parentID
+	tc.Flags = byte(f)
+	return tc, true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		for _, c := range b {
+			if c != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
+
+type traceState struct {
+	exporter SpanExporter
+	sampled  bool
+	current  *Span
+	state    string
+}
+
+func newChildSpan(name string, parent *Span) *Span {
+	return &Span{
+		TraceID:  parent.TraceID,
+		SpanID:   randomHex(8),
+		ParentID: parent.SpanID,
+		Name:     name,
+		Start:    time.Now(),
+	}
+}
+
+func (t *traceState) finish(span *Span) {
+	span.End = time.Now()
+	if t.sampled {
+		t.exporter.Export(span)
+	}
+}
+
+const traceStateKey = "roboot.filters.trace"
+
+// CurrentSpan return the innermost active span of the request, it's nil if the request
+// is not traced.
+func CurrentSpan(ctx *roboot.Context) *Span {
+	state, _ := ctx.ContextValue(traceStateKey).(*traceState)
+	if state == nil {
+		return nil
+	}
+	return state.current
+}
+
+// InjectTraceContext set traceparent and tracestate headers for outgoing requests.
+func InjectTraceContext(ctx *roboot.Context, header http.Header) {
+	state, _ := ctx.ContextValue(traceStateKey).(*traceState)
+	if state == nil {
+		return
+	}
+	var flags byte
+	if state.sampled {
+		flags |= traceFlagSampled
+	}
+	header.Set(roboot.HeaderTraceParent, fmt.Sprintf("%s-%s-%s-%02x", traceVersion, state.current.TraceID, state.current.SpanID, flags))
+	if state.state != "" {
+		header.Set(roboot.HeaderTraceState, state.state)
+	}
+}
+
+// Tracing create a span for each request named after the matched route pattern, and
+// child spans for each filter after it in the chain.
+type Tracing struct {
+	Exporter SpanExporter // default discard all spans
+}
+
+type traceFilter struct {
+	exporter SpanExporter
+}
+
+type discardSpanExporter struct{}
+
+func (discardSpanExporter) Export(*Span) {}
+
+func (t *Tracing) ToFilter() roboot.Filter {
+	f := traceFilter{
+		exporter: t.Exporter,
+	}
+	if f.exporter == nil {
+		f.exporter = discardSpanExporter{}
+	}
+	return &f
+}
+
+func (f *traceFilter) filterHook(state *traceState, prev roboot.FilterHook) roboot.FilterHook {
+	return func(ctx *roboot.Context, filter roboot.Filter) func() {
+		var prevDone func()
+		if prev != nil {
+			prevDone = prev(ctx, filter)
+		}
+		parent := state.current
+		span := newChildSpan(fmt.Sprintf("%T", filter), parent)
+		state.current = span
+		return func() {
+			state.current = parent
+			state.finish(span)
+			if prevDone != nil {
+				prevDone()
+			}
+		}
+	}
+}
+
+func (f *traceFilter) Filter(ctx *roboot.Context, chain roboot.Handler) {
+	state := traceState{
+		exporter: f.exporter,
+		sampled:  true,
+	}
+	root := Span{
+		SpanID: randomHex(8),
+		Name:   ctx.RoutePattern(),
+		Start:  time.Now(),
+	}
+	if root.Name == "" {
+		root.Name = ctx.Req.Method
+	}
+	if tc, ok := ParseTraceParent(ctx.Req.Header.Get(roboot.HeaderTraceParent)); ok {
+		root.TraceID = tc.TraceID
+		root.ParentID = tc.ParentID
+		state.sampled = tc.Flags&traceFlagSampled != 0
+		state.state = strings.TrimSpace(strings.Join(ctx.Req.Header[http.CanonicalHeaderKey(roboot.HeaderTraceState)], ","))
+	} else {
+		root.TraceID = randomHex(16)
+	}
+	root.SetAttribute("http.method", ctx.Req.Method)
+	root.SetAttribute("http.target", ctx.Req.URL.RequestURI())
+	state.current = &root
+	ctx.SetContextValue(traceStateKey, &state)
+
+	InjectTraceContext(ctx, ctx.Resp.Header())
+	prevHook := ctx.FilterHook()
+	ctx.SetFilterHook(f.filterHook(&state, prevHook))
+	defer func() {
+		ctx.SetFilterHook(prevHook)
+		root.SetAttribute("http.status_code", strconv.Itoa(ctx.Resp.StatusCode()))
+		state.finish(&root)
+	}()
+
+	chain.Handle(ctx)
+}
@@ -0,0 +1,50 @@
+package filters_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/filters"
+)
+
+func TestTracing(t *testing.T) {
+	var (
+		exporter filters.MemorySpanExporter
+		tracing  = filters.Tracing{Exporter: &exporter}
+		nop      = roboot.FilterFunc(func(ctx *roboot.Context, chain roboot.Handler) { chain.Handle(ctx) })
+	)
+	s := newServer(t, "/user/:id", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		if filters.CurrentSpan(ctx) == nil {
+			t.Error("current span should not be nil")
+		}
+	}), tracing.ToFilter(), nop)
+
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID = "00f067aa0ba902b7"
+	)
+	req, _ := http.NewRequest("GET", "/user/1", nil)
+	req.Header.Set(roboot.HeaderTraceParent, "00-"+traceID+"-"+parentID+"-01")
+	resp := serve(s, req)
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expect 2 spans, got %d", len(spans))
+	}
+	child, root := spans[0], spans[1]
+	if root.Name != "/user/:id" || root.TraceID != traceID || root.ParentID != parentID {
+		t.Fatalf("unexpected root span: %+v", root)
+	}
+	if child.TraceID != traceID || child.ParentID != root.SpanID {
+		t.Fatalf("unexpected child span: %+v", child)
+	}
+	if !strings.Contains(resp.Header().Get(roboot.HeaderTraceParent), root.SpanID) {
+		t.Fatal("traceparent should be emitted")
+	}
+
+	if _, ok := filters.ParseTraceParent("00-" + strings.Repeat("0", 32) + "-" + parentID + "-01"); ok {
+		t.Fatal("all zero trace id should be rejected")
+	}
+}
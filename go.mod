@@ -1,3 +1,5 @@
 module github.com/cosiner/roboot
 
+go 1.27.1
+
 require github.com/cosiner/router v0.0.1
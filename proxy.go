@@ -0,0 +1,218 @@
+package roboot
+
+import (
+	"net"
+	"strings"
+)
+
+// ParseCIDRs parse networks in CIDR notation, single ip address is also accepted.
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if strings.IndexByte(cidr, '/') < 0 {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: cidr}
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+type remoteInfo struct {
+	clientIP string
+	scheme   string
+	host     string
+}
+
+func splitHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+func (e *Env) isTrustedProxy(addr string) bool {
+	if len(e.TrustedProxies) == 0 {
+		return false
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range e.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func headerValues(values []string) []string {
+	var items []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// forwardedNode strip the quotes, brackets and port of a RFC 7239 node.
+func forwardedNode(node string) string {
+	node = strings.Trim(node, `"`)
+	if strings.HasPrefix(node, "[") {
+		if end := strings.IndexByte(node, ']'); end > 0 {
+			return node[1:end]
+		}
+		return node
+	}
+	if strings.Count(node, ":") == 1 {
+		return node[:strings.IndexByte(node, ':')]
+	}
+	return node
+}
+
+// parseForwarded parse RFC 7239 Forwarded header values into elements of key-value pairs,
+// keys are lower cased.
+func parseForwarded(values []string) []map[string]string {
+	items := headerValues(values)
+	elems := make([]map[string]string, 0, len(items))
+	for _, item := range items {
+		elem := make(map[string]string)
+		for _, pair := range strings.Split(item, ";") {
+			index := strings.IndexByte(pair, '=')
+			if index <= 0 {
+				continue
+			}
+			key := strings.ToLower(strings.TrimSpace(pair[:index]))
+			elem[key] = strings.Trim(strings.TrimSpace(pair[index+1:]), `"`)
+		}
+		elems = append(elems, elem)
+	}
+	return elems
+}
+
+// clientIndex walk the forwarded addresses from right to left, skip trusted proxies
+// and return the index of first untrusted one, or the leftmost if all are trusted.
+func (e *Env) clientIndex(addrs []string) int {
+	for i := len(addrs) - 1; i > 0; i-- {
+		if !e.isTrustedProxy(addrs[i]) {
+			return i
+		}
+	}
+	return 0
+}
+
+// forwardedValue pick the X-Forwarded-Proto or X-Forwarded-Host value appended along
+// with the client address at index client of n forwarded addresses, values on the left
+// of it are controlled by client. The last value set by the nearest proxy is used if
+// the values are not appended for each address.
+func forwardedValue(values []string, n, client int) string {
+	items := headerValues(values)
+	switch {
+	case len(items) == 0:
+		return ""
+	case len(items) == n:
+		return items[client]
+	default:
+		return items[len(items)-1]
+	}
+}
+
+func (ctx *Context) remoteInfo() *remoteInfo {
+	if ctx.remote != nil {
+		return ctx.remote
+	}
+
+	var (
+		req    = ctx.Req
+		remote = remoteInfo{
+			clientIP: splitHost(req.RemoteAddr),
+			scheme:   "http",
+			host:     req.Host,
+		}
+	)
+	if req.TLS != nil {
+		remote.scheme = "https"
+	}
+	ctx.remote = &remote
+	if !ctx.env.isTrustedProxy(remote.clientIP) {
+		return ctx.remote
+	}
+
+	if forwarded := req.Header[HeaderForwarded]; len(forwarded) > 0 {
+		elems := parseForwarded(forwarded)
+		if len(elems) == 0 {
+			return ctx.remote
+		}
+		addrs := make([]string, len(elems))
+		for i := range elems {
+			addrs[i] = forwardedNode(elems[i]["for"])
+		}
+		client := ctx.env.clientIndex(addrs)
+		if addrs[client] != "" {
+			remote.clientIP = addrs[client]
+		}
+		if proto := elems[client]["proto"]; proto != "" {
+			remote.scheme = strings.ToLower(proto)
+		}
+		if host := elems[client]["host"]; host != "" {
+			remote.host = host
+		}
+		return ctx.remote
+	}
+
+	addrs := headerValues(req.Header[HeaderXForwardedFor])
+	var client int
+	if len(addrs) > 0 {
+		for i := range addrs {
+			addrs[i] = splitHost(addrs[i])
+		}
+		client = ctx.env.clientIndex(addrs)
+		remote.clientIP = addrs[client]
+	} else if realIP := strings.TrimSpace(req.Header.Get(HeaderXRealIP)); realIP != "" {
+		remote.clientIP = splitHost(realIP)
+	}
+	if proto := forwardedValue(req.Header[HeaderXForwardedProto], len(addrs), client); proto != "" {
+		remote.scheme = strings.ToLower(proto)
+	}
+	if host := forwardedValue(req.Header[HeaderXForwardedHost], len(addrs), client); host != "" {
+		remote.host = host
+	}
+	return ctx.remote
+}
+
+// ClientIP return the client address, forwarding headers such as Forwarded, X-Forwarded-For
+// and X-Real-IP are only used if the peer is a trusted proxy.
+func (ctx *Context) ClientIP() string {
+	return ctx.remoteInfo().clientIP
+}
+
+// Scheme return the request scheme, "http" or "https" typically.
+func (ctx *Context) Scheme() string {
+	return ctx.remoteInfo().scheme
+}
+
+// Host return the host requested by client.
+func (ctx *Context) Host() string {
+	return ctx.remoteInfo().host
+}
@@ -0,0 +1,49 @@
+package roboot_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/codec"
+	"github.com/cosiner/roboot/router"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := roboot.ParseCIDRs("10.0.0.0/8", "::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := roboot.NewServer(roboot.Env{Codec: codec.JSON, Error: errorHandler{}, TrustedProxies: trusted}, router.New())
+	s.Router("").Handle("/", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		ctx.Resp.Write([]byte(ctx.ClientIP() + " " + ctx.Scheme() + " " + ctx.Host()))
+	}))
+
+	tests := []struct {
+		remote  string
+		headers map[string]string
+		expect  string
+	}{
+		{"192.168.1.1:80", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "192.168.1.1 http example.com"},
+		{"10.0.0.1:80", map[string]string{"X-Forwarded-For": "1.1.1.1, 2.2.2.2, 10.0.0.2", "X-Forwarded-Proto": "https"}, "2.2.2.2 https example.com"},
+		{"10.0.0.1:80", map[string]string{"X-Real-IP": "3.3.3.3"}, "3.3.3.3 http example.com"},
+		// values on the left of the client are spoofed
+		{"10.0.0.1:80", map[string]string{"X-Forwarded-For": "1.1.1.1, 2.2.2.2", "X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "evil.com, a.com"}, "2.2.2.2 http a.com"},
+		{"10.0.0.1:80", map[string]string{"X-Forwarded-For": "1.1.1.1, 2.2.2.2, 10.0.0.2", "X-Forwarded-Proto": "https, http"}, "2.2.2.2 http example.com"},
+		{"[::1]:80", map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https;host=a.com, for=10.0.0.3`}, "2001:db8::1 https a.com"},
+	}
+	for i, test := range tests {
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		req.URL.Host = ""
+		req.RemoteAddr = test.remote
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, req)
+		if got := recorder.Body.String(); got != test.expect {
+			t.Errorf("%d: expect %q, got %q", i, test.expect, got)
+		}
+	}
+}
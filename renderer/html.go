@@ -8,14 +8,26 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/cosiner/roboot"
 )
 
 type htmlTemplate struct {
 	template *template.Template
+	pristine *template.Template // never executed, cloned for requests with CSP nonce
+	nonces   sync.Pool          // *nonceTemplate
 }
 
+// nonceTemplate is a clone whose cspNonce function return the nonce of the request
+// executing it, it's reused to avoid cloning and escaping templates for each request.
+type nonceTemplate struct {
+	template *template.Template
+	nonce    string
+}
+
+const cspNonceFunc = "cspNonce"
+
 type HTML struct {
 	Pathes        map[string]string // <path, trimPrefix>
 	AllowSuffixes []string
@@ -25,6 +37,7 @@ type HTML struct {
 
 func (h HTML) ToRenderer() (roboot.Renderer, error) {
 	root := template.New("")
+	root.Funcs(template.FuncMap{cspNonceFunc: func() string { return "" }})
 	if len(h.Funcs) > 0 {
 		root.Funcs(h.Funcs)
 	}
@@ -46,6 +59,11 @@ func (h HTML) ToRenderer() (roboot.Renderer, error) {
 			return nil, err
 		}
 	}
+	pristine, err := root.Clone()
+	if err != nil {
+		return nil, err
+	}
+	t.pristine = pristine
 	return t, nil
 }
 
@@ -96,3 +114,33 @@ func (h *htmlTemplate) loadPath(trimPrefix, path string, suffixes ...string) err
 func (h *htmlTemplate) Render(w io.Writer, name string, v interface{}) error {
 	return h.template.ExecuteTemplate(w, name, v)
 }
+
+func (h *htmlTemplate) RenderContext(ctx *roboot.Context, w io.Writer, name string, v interface{}) error {
+	nonce, _ := ctx.ContextValue(roboot.ContextValueCSPNonce).(string)
+	if nonce == "" {
+		return h.Render(w, name, v)
+	}
+
+	t, err := h.nonceTemplate()
+	if err != nil {
+		return err
+	}
+	t.nonce = nonce
+	err = t.template.ExecuteTemplate(w, name, v)
+	t.nonce = ""
+	h.nonces.Put(t)
+	return err
+}
+
+func (h *htmlTemplate) nonceTemplate() (*nonceTemplate, error) {
+	if t, ok := h.nonces.Get().(*nonceTemplate); ok {
+		return t, nil
+	}
+	clone, err := h.pristine.Clone()
+	if err != nil {
+		return nil, err
+	}
+	t := &nonceTemplate{template: clone}
+	clone.Funcs(template.FuncMap{cspNonceFunc: func() string { return t.nonce }})
+	return t, nil
+}
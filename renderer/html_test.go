@@ -0,0 +1,84 @@
+package renderer_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/cosiner/roboot"
+	"github.com/cosiner/roboot/codec"
+	"github.com/cosiner/roboot/filters"
+	"github.com/cosiner/roboot/renderer"
+	"github.com/cosiner/roboot/router"
+)
+
+type errorHandler struct {
+	t *testing.T
+}
+
+func (e errorHandler) Log(ctx *roboot.Context, errType roboot.ErrType, err error) {
+	e.t.Error(err)
+}
+
+func (errorHandler) Handle(ctx *roboot.Context, callerDepth int, status int, err error) {
+	ctx.Status(status)
+}
+
+func TestHTMLCSPNonce(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(`<script nonce="{{cspNonce}}">{{.}}</script>`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := renderer.HTML{Pathes: map[string]string{dir: dir}}.ToRenderer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := roboot.NewServer(roboot.Env{Codec: codec.JSON, Error: errorHandler{t}, Renderer: r}, router.New())
+	handler := roboot.HandlerFunc(func(ctx *roboot.Context) {
+		ctx.Render("/index.html", "1")
+	})
+	secure := filters.Secure{ContentSecurityPolicy: "script-src 'nonce-{nonce}'"}
+	if err := s.Router("").Handle("/nonce", handler, secure.ToFilter()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Router("").Handle("/", handler); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	resp := httptest.NewRecorder()
+	s.ServeHTTP(resp, req)
+	if body := resp.Body.String(); body != `<script nonce="">"1"</script>` {
+		t.Errorf("expect empty nonce, got %s", body)
+	}
+
+	policy := regexp.MustCompile(`'nonce-(.+)'`)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				req, _ := http.NewRequest("GET", "/nonce", nil)
+				resp := httptest.NewRecorder()
+				s.ServeHTTP(resp, req)
+				m := policy.FindStringSubmatch(resp.Header().Get(roboot.HeaderContentSecurityPolicy))
+				if m == nil {
+					t.Error("expect nonce in policy")
+					return
+				}
+				if body := resp.Body.String(); body != `<script nonce="`+m[1]+`">"1"</script>` {
+					t.Errorf("expect nonce %s, got %s", m[1], body)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
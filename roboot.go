@@ -9,6 +9,9 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 //==============================================================================
@@ -47,6 +50,12 @@ type (
 		Render(io.Writer, string, interface{}) error
 	}
 
+	// ContextRenderer is optionally implemented by Renderer to access the request
+	// context such as CSP nonce.
+	ContextRenderer interface {
+		RenderContext(ctx *Context, w io.Writer, name string, v interface{}) error
+	}
+
 	ErrType uint8
 
 	ErrorHandler interface {
@@ -63,6 +72,9 @@ type (
 			MaxMemory int64
 		}
 		Renderer Renderer
+
+		// forwarding headers are only honoured if peer address is in these networks
+		TrustedProxies []*net.IPNet
 	}
 )
 
@@ -103,11 +115,13 @@ func (e ErrType) String() string {
 type (
 	ResponseWriter interface {
 		StatusCode() int
+		BytesWritten() int64
 		http.ResponseWriter
 	}
 
 	respWriter struct {
 		statusCode int
+		written    int64
 		http.ResponseWriter
 	}
 
@@ -121,12 +135,17 @@ type (
 		Resp  ResponseWriter
 		Codec Codec
 
-		env       *Env
-		encoder   Encoder
-		decoder   Decoder
-		urlQuery  url.Values
-		urlParams Params
-		ctxValues map[string]interface{}
+		env        *Env
+		encoder    Encoder
+		decoder    Decoder
+		urlQuery   url.Values
+		urlParams  Params
+		ctxValues  map[string]interface{}
+		remote     *remoteInfo
+		pattern    string
+		requestID  string
+		filterHook FilterHook
+		lastErr    error
 	}
 )
 
@@ -140,6 +159,7 @@ func (r *respWriter) WriteHeader(status int) {
 
 func (r *respWriter) Write(b []byte) (int, error) {
 	n, err := r.ResponseWriter.Write(b)
+	r.written += int64(n)
 	if err == nil && r.statusCode == 0 {
 		r.statusCode = http.StatusOK
 	}
@@ -164,10 +184,43 @@ func (r *respWriter) StatusCode() int {
 	return r.statusCode
 }
 
+func (r *respWriter) BytesWritten() int64 {
+	return r.written
+}
+
+// HeaderWritten report whether the response header has been sent.
+func (r *respWriter) HeaderWritten() bool {
+	return r.statusCode > 0
+}
+
 func (ctx *Context) Env() *Env {
 	return ctx.env
 }
 
+// RoutePattern return the pattern of matched route, it's empty if no route matched.
+func (ctx *Context) RoutePattern() string {
+	return ctx.pattern
+}
+
+// RequestID return the request id set by filters, it's used to correlate logs.
+func (ctx *Context) RequestID() string {
+	return ctx.requestID
+}
+
+func (ctx *Context) SetRequestID(id string) {
+	ctx.requestID = id
+}
+
+func (ctx *Context) FilterHook() FilterHook {
+	return ctx.filterHook
+}
+
+// SetFilterHook set the hook for remaining filters of the chain, to keep hook set by
+// others, the new hook should call the previous one.
+func (ctx *Context) SetFilterHook(hook FilterHook) {
+	ctx.filterHook = hook
+}
+
 func (ctx *Context) ParamValue(name string) string {
 	return ctx.urlParams.Get(name)
 }
@@ -223,6 +276,23 @@ func (ctx *Context) SetContextValue(name string, val interface{}) {
 	ctx.ctxValues[name] = val
 }
 
+// Clone create a shallow copy of the context with it's own context values, it's used
+// to process the request in another goroutine. Encoder, decoder and filter hook are
+// not shared with the copy.
+func (ctx *Context) Clone() *Context {
+	c := *ctx
+	c.encoder = nil
+	c.decoder = nil
+	c.filterHook = nil
+	if ctx.ctxValues != nil {
+		c.ctxValues = make(map[string]interface{}, len(ctx.ctxValues))
+		for k, v := range ctx.ctxValues {
+			c.ctxValues[k] = v
+		}
+	}
+	return &c
+}
+
 func (ctx *Context) multipartFormValues() *multipart.Form {
 	const defaultMaxMemory = 32 << 20 // 32M
 	if ctx.Req.MultipartForm == nil {
@@ -305,7 +375,12 @@ func (ctx *Context) Render(name string, v interface{}) {
 		ctx.Error(errEmptyRenderer, http.StatusInternalServerError)
 		return
 	}
-	err := renderer.Render(ctx.Resp, name, v)
+	var err error
+	if cr, ok := renderer.(ContextRenderer); ok {
+		err = cr.RenderContext(ctx, ctx.Resp, name, v)
+	} else {
+		err = renderer.Render(ctx.Resp, name, v)
+	}
 	if err != nil {
 		ctx.env.Error.Log(ctx, ErrTypeRender, err)
 	}
@@ -315,9 +390,15 @@ func (ctx *Context) Error(err error, statusCode int) {
 	if err == nil {
 		panic(fmt.Errorf("expect non-nil error"))
 	}
+	ctx.lastErr = err
 	ctx.Env().Error.Handle(ctx, 1, statusCode, err)
 }
 
+// LastError return the last error passed to Error.
+func (ctx *Context) LastError() error {
+	return ctx.lastErr
+}
+
 //==============================================================================
 //                                Handler
 //==============================================================================
@@ -334,9 +415,14 @@ type (
 
 	FilterFunc func(ctx *Context, chain Handler)
 
+	// FilterHook is called before each filter of the chain is invoked, the returned
+	// function is called after the filter returns.
+	FilterHook func(ctx *Context, filter Filter) func()
+
 	MatchedHandler struct {
 		Handler
 		Params
+		Pattern string
 	}
 
 	MatchedFilter struct {
@@ -345,15 +431,42 @@ type (
 	}
 
 	Router interface {
-		Handle(path string, handler Handler) error
+		// filters are only applied to the handler, rather than all routes under the path
+		Handle(path string, handler Handler, filters ...Filter) error
 		Filter(path string, filters ...Filter) error
-		Group(prefix string) Router
+		// filters are applied to all routes handled by the group
+		Group(prefix string, filters ...Filter) Router
 		Merge(prefix string, r Router) error
 
 		MatchHandler(path string) MatchedHandler
 		MatchFilters(path string) []MatchedFilter
 		MatchHandlerAndFilters(path string) (MatchedHandler, []MatchedFilter)
 	}
+
+	Route struct {
+		Pattern        string
+		Handler        Handler  // nil if only filters are attached
+		HandlerFilters []Filter // filters only applied to the handler
+		Filters        []Filter
+	}
+
+	// RouteEnumerator is optionally implemented by Router to list registered routes in
+	// the order of registration.
+	RouteEnumerator interface {
+		Routes() []Route
+	}
+
+	// RouteRemover is optionally implemented by Router to unregister routes.
+	RouteRemover interface {
+		RemoveHandler(path string) error
+		RemoveFilters(path string) error
+	}
+
+	// PathRedirector is optionally implemented by Router to redirect requests to the
+	// canonical path, matched report whether the path matches any handler.
+	PathRedirector interface {
+		RedirectPath(path string, matched bool) (string, bool)
+	}
 )
 
 func (f HandlerFunc) Handle(ctx *Context) {
@@ -371,13 +484,20 @@ type (
 	Server interface {
 		Env() *Env
 		Router(h string) Router
+		// Host replace the router of the host atomically, in-flight requests keep
+		// using the old router.
 		Host(h string, r Router)
 		http.Handler
 	}
 
-	server struct {
+	hostRouters struct {
 		defaultRouter Router
 		routers       map[string]Router
+	}
+
+	server struct {
+		mu      sync.Mutex   // serialize Host calls
+		routers atomic.Value // *hostRouters, replaced by Host
 
 		env Env
 	}
@@ -397,21 +517,28 @@ func (f *filterHandler) Handle(ctx *Context) {
 		filter := f.filters[0]
 		f.filters = f.filters[1:]
 		ctx.urlParams = filter.Params
-		filter.Filter.Filter(ctx, f)
+		f.callFilter(ctx, filter.Filter)
 	}
 	ctx.urlParams = oldP
 }
 
+func (f *filterHandler) callFilter(ctx *Context, filter Filter) {
+	if ctx.filterHook != nil {
+		defer ctx.filterHook(ctx, filter)()
+	}
+	filter.Filter(ctx, f)
+}
+
 func NewServer(env Env, defaultRouter Router) Server {
 	if env.Error == nil || env.Codec == nil {
 		panic("error handler and codec should not be empty")
 	}
 
-	return &server{
-		defaultRouter: defaultRouter,
-
+	s := &server{
 		env: env,
 	}
+	s.routers.Store(&hostRouters{defaultRouter: defaultRouter})
+	return s
 }
 
 func (s *server) Env() *Env {
@@ -419,22 +546,34 @@ func (s *server) Env() *Env {
 }
 
 func (s *server) Router(host string) Router {
-	r, has := s.routers[host]
+	routers := s.routers.Load().(*hostRouters)
+	r, has := routers.routers[host]
 	if !has || r == nil {
-		r = s.defaultRouter
+		r = routers.defaultRouter
 	}
 	return r
 }
 
 func (s *server) Host(host string, r Router) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		old     = s.routers.Load().(*hostRouters)
+		routers = hostRouters{
+			defaultRouter: old.defaultRouter,
+			routers:       make(map[string]Router, len(old.routers)+1),
+		}
+	)
+	for h, r := range old.routers {
+		routers.routers[h] = r
+	}
 	if host == "" {
-		s.defaultRouter = r
+		routers.defaultRouter = r
 	} else {
-		if s.routers == nil {
-			s.routers = make(map[string]Router)
-		}
-		s.routers[host] = r
+		routers.routers[host] = r
 	}
+	s.routers.Store(&routers)
 }
 
 func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -450,6 +589,12 @@ func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 
 	handler, filters := r.MatchHandlerAndFilters(req.URL.Path)
+	if redirector, ok := r.(PathRedirector); ok {
+		if path, ok := redirector.RedirectPath(req.URL.Path, handler.Handler != nil); ok {
+			handler = MatchedHandler{Handler: redirectHandler(path)}
+		}
+	}
+	ctx.pattern = handler.Pattern
 	if handler.Handler == nil {
 		handler.Handler = HandlerFunc(func(ctx *Context) {
 			ctx.Error(newError("resource not found"), http.StatusNotFound)
@@ -460,3 +605,18 @@ func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		handler: handler,
 	}).Handle(&ctx)
 }
+
+// redirectHandler redirect to path with the query kept, 301 for GET and HEAD, 308 for
+// others to preserve method and body.
+func redirectHandler(path string) Handler {
+	// avoid redirecting to other hosts such as //example.com
+	path = "/" + strings.TrimLeft(path, "/\\")
+	return HandlerFunc(func(ctx *Context) {
+		target := (&url.URL{Path: path, RawQuery: ctx.Req.URL.RawQuery}).String()
+		code := http.StatusPermanentRedirect
+		if ctx.Req.Method == MethodGet || ctx.Req.Method == MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(ctx.Resp, ctx.Req, target, code)
+	})
+}
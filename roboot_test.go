@@ -50,3 +50,253 @@ func TestRoboot(t *testing.T) {
 		t.Fatal("process failed")
 	}
 }
+
+func TestRedirectPath(t *testing.T) {
+	s := roboot.NewServer(roboot.Env{Codec: codec.JSON, Error: errorHandler{}}, router.NewWithOptions(router.Options{
+		TrailingSlash:   router.TrailingSlashStrip,
+		CleanPath:       true,
+		CaseInsensitive: true,
+	}))
+	r := s.Router("")
+	r.Handle("/users/:id", roboot.HandlerFunc(func(ctx *roboot.Context) {
+		ctx.Resp.Write([]byte(ctx.ParamValue("id")))
+	}))
+	r.Handle("/Docs/*path", roboot.HandlerFunc(func(ctx *roboot.Context) {}))
+	r.Handle("/Codes/:code<[A-Z]{3}>", roboot.HandlerFunc(func(ctx *roboot.Context) {}))
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{"GET", "/users/Tom", http.StatusOK, ""},
+		{"GET", "/users/Tom/?a=1", http.StatusMovedPermanently, "/users/Tom?a=1"},
+		{"GET", "/users/../users/Tom", http.StatusMovedPermanently, "/users/Tom"},
+		{"GET", "/users//Tom", http.StatusMovedPermanently, "/users/Tom"},
+		{"POST", "/USERS/Tom", http.StatusPermanentRedirect, "/users/Tom"},
+		{"GET", "/docs/A/b", http.StatusMovedPermanently, "/Docs/A/b"},
+		{"GET", "/groups/1", http.StatusNotFound, ""},
+		{"GET", "/codes/ABC", http.StatusMovedPermanently, "/Codes/ABC"},
+		{"GET", "/codes/abc", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.path, nil)
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, req)
+		if recorder.Code != test.status {
+			t.Errorf("%s %s: expect status %d, got %d", test.method, test.path, test.status, recorder.Code)
+		}
+		if location := recorder.Header().Get("Location"); location != test.location {
+			t.Errorf("%s %s: expect location %s, got %s", test.method, test.path, test.location, location)
+		}
+	}
+}
+
+func TestRouteConstraint(t *testing.T) {
+	if err := router.RegisterConstraint("lang", `[a-z]{2}`); err != nil {
+		t.Fatal(err)
+	}
+	s := roboot.NewServer(roboot.Env{Codec: codec.JSON, Error: errorHandler{}}, router.New())
+	r := s.Router("")
+	for _, pattern := range []string{"/users/:id<int>", "/users/:uuid<uuid>", "/users/:slug<[a-z-]+>", "/docs/:lang<lang>/*path"} {
+		pattern := pattern
+		if err := r.Handle(pattern, roboot.HandlerFunc(func(ctx *roboot.Context) {
+			ctx.Resp.Write([]byte(pattern))
+		})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Handle("/bad/:id<int", roboot.HandlerFunc(func(ctx *roboot.Context) {})); err == nil {
+		t.Error("invalid constraint should be rejected")
+	}
+
+	tests := map[string]string{
+		"/users/123": "/users/:id<int>",
+		"/users/3f2504e0-4f89-11d3-9a0c-0305e82c3301": "/users/:uuid<uuid>",
+		"/users/hello-world":                          "/users/:slug<[a-z-]+>",
+		"/users/Hello":                                "",
+		"/users/12a":                                  "",
+		"/docs/en/intro":                              "/docs/:lang<lang>/*path",
+		"/docs/eng/intro":                             "",
+	}
+	for path, pattern := range tests {
+		req, _ := http.NewRequest("GET", path, nil)
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, req)
+		if pattern == "" {
+			if recorder.Code != http.StatusNotFound {
+				t.Errorf("%s: expect not found, got %d", path, recorder.Code)
+			}
+		} else if recorder.Body.String() != pattern {
+			t.Errorf("%s: expect %s, got %s", path, pattern, recorder.Body.String())
+		}
+	}
+}
+
+func TestRouterMerge(t *testing.T) {
+	handler := func(name string) roboot.Handler {
+		return roboot.HandlerFunc(func(ctx *roboot.Context) {
+			ctx.Resp.Write([]byte(name + ":" + ctx.RoutePattern()))
+		})
+	}
+	users := router.New()
+	users.Handle("/", handler("list"))
+	users.Handle("/:id", handler("get"))
+
+	module := router.New()
+	module.Handle("/health", handler("health"))
+	g := module.Group("/orders")
+	g.Handle("/:id", handler("order"))
+
+	s := roboot.NewServer(roboot.Env{Codec: codec.JSON, Error: errorHandler{}}, router.New())
+	r := s.Router("")
+	if err := r.Merge("/users", users); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Merge("/api", g); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"/users":          "list:/users/",
+		"/users/1":        "get:/users/:id",
+		"/api/orders/1":   "order:/api/orders/:id",
+		"/api/health":     "",
+		"/api/orders/1/x": "",
+	}
+	for path, expect := range tests {
+		req, _ := http.NewRequest("GET", path, nil)
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, req)
+		if expect == "" {
+			if recorder.Code != http.StatusNotFound {
+				t.Errorf("%s: expect not found, got %d", path, recorder.Code)
+			}
+		} else if recorder.Body.String() != expect {
+			t.Errorf("%s: expect %s, got %s", path, expect, recorder.Body.String())
+		}
+	}
+	if routes := r.(roboot.RouteEnumerator).Routes(); len(routes) != 3 {
+		t.Errorf("expect 3 routes, got %d", len(routes))
+	}
+}
+
+func TestGroupFilters(t *testing.T) {
+	mark := func(name string) roboot.Filter {
+		return roboot.FilterFunc(func(ctx *roboot.Context, chain roboot.Handler) {
+			ctx.Resp.Write([]byte(name + ","))
+			chain.Handle(ctx)
+		})
+	}
+	handler := roboot.HandlerFunc(func(ctx *roboot.Context) {
+		ctx.Resp.Write([]byte(ctx.ParamValue("id")))
+	})
+
+	s := roboot.NewServer(roboot.Env{Codec: codec.JSON, Error: errorHandler{}}, router.New())
+	r := s.Router("")
+	r.Filter("/api/*", mark("path"))
+	api := r.Group("/api", mark("api"))
+	api.Handle("/public/:id", handler)
+	admin := api.Group("/admin", mark("admin"))
+	admin.Handle("/users/:id", handler, mark("route"))
+	r.Handle("/other/:id", handler)
+	sub := router.New()
+	sub.Handle("/items/:id", handler, mark("route"))
+	sub.Filter("/items/:id", mark("sub"))
+	if err := admin.Merge("/sub", sub); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"/api/public/1":          "path,api,1",
+		"/api/admin/users/2":     "path,api,admin,route,2",
+		"/api/admin/sub/items/4": "path,sub,api,admin,route,4",
+		"/other/3":               "3",
+	}
+	for path, expect := range tests {
+		req, _ := http.NewRequest("GET", path, nil)
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, req)
+		if recorder.Body.String() != expect {
+			t.Errorf("%s: expect %s, got %s", path, expect, recorder.Body.String())
+		}
+	}
+}
+
+func TestRouteRemoveAndSwap(t *testing.T) {
+	text := func(s string) roboot.Handler {
+		return roboot.HandlerFunc(func(ctx *roboot.Context) {
+			ctx.Resp.Write([]byte(s))
+		})
+	}
+	get := func(s roboot.Server, path string) string {
+		req, _ := http.NewRequest("GET", path, nil)
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, req)
+		return recorder.Body.String()
+	}
+
+	s := roboot.NewServer(roboot.Env{Codec: codec.JSON, Error: errorHandler{}}, router.New())
+	r := s.Router("")
+	r.Handle("/a", text("a"))
+	r.Handle("/b", text("b"))
+	r.Filter("/b", roboot.FilterFunc(func(ctx *roboot.Context, chain roboot.Handler) {
+		ctx.Resp.Write([]byte("filtered,"))
+		chain.Handle(ctx)
+	}))
+
+	remover := r.(roboot.RouteRemover)
+	if err := remover.RemoveHandler("/a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := remover.RemoveHandler("/a"); err == nil {
+		t.Error("removing absent route should fail")
+	}
+	if err := remover.RemoveFilters("/b"); err != nil {
+		t.Fatal(err)
+	}
+	if body := get(s, "/a"); body == "a" {
+		t.Error("route should be removed")
+	}
+	if body := get(s, "/b"); body != "b" {
+		t.Errorf("expect b, got %s", body)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			get(s, "/b")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		nr := router.New()
+		nr.Handle("/b", text("new"))
+		s.Host("", nr)
+		r.Handle("/c", text("c"))
+		r.(roboot.RouteRemover).RemoveHandler("/c")
+	}
+	<-done
+	if body := get(s, "/b"); body != "new" {
+		t.Errorf("expect new, got %s", body)
+	}
+}
+
+// plainRouter hide optional interfaces of the underlying router.
+type plainRouter struct {
+	roboot.Router
+}
+
+func TestRouterMergeUnsupported(t *testing.T) {
+	custom := plainRouter{router.New()}
+	custom.Handle("/a", roboot.HandlerFunc(func(ctx *roboot.Context) {}))
+
+	r := router.New()
+	if err := r.Merge("/", custom); err == nil {
+		t.Error("merging router without route enumeration should fail")
+	}
+	if err := r.Merge("/", router.Group(custom, "/g")); err == nil {
+		t.Error("merging group over router without route enumeration should fail")
+	}
+}
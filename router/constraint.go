@@ -0,0 +1,75 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	constraintsMu sync.RWMutex
+	constraints   = map[string]string{
+		"int":   `-?[0-9]+`,
+		"uint":  `[0-9]+`,
+		"alpha": `[a-zA-Z]+`,
+		"alnum": `[a-zA-Z0-9]+`,
+		"hex":   `[0-9a-fA-F]+`,
+		"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	}
+)
+
+// RegisterConstraint register a named constraint used as :name<constraint> in route
+// patterns, the expression must match the whole parameter value. It should be called
+// before routes are added.
+func RegisterConstraint(name, expr string) error {
+	if name == "" || strings.ContainsAny(name, "<>/") {
+		return fmt.Errorf("invalid constraint name: %s", name)
+	}
+	if _, err := regexp.Compile(expr); err != nil {
+		return err
+	}
+	constraintsMu.Lock()
+	constraints[name] = expr
+	constraintsMu.Unlock()
+	return nil
+}
+
+// parseConstraint translate constrained parameter such as :id<int> or :slug<[a-z-]+>
+// to the :name:regexp syntax, the value must match the whole segment.
+func parseConstraint(seg string) (string, error) {
+	begin := strings.IndexByte(seg, '<')
+	if begin < 0 || strings.IndexByte(seg[:begin], ':') > 0 {
+		return seg, nil
+	}
+	if !strings.HasSuffix(seg, ">") || begin == len(seg)-2 {
+		return "", fmt.Errorf("invalid constraint: %s", seg)
+	}
+	expr := seg[begin+1 : len(seg)-1]
+	constraintsMu.RLock()
+	if named, has := constraints[expr]; has {
+		expr = named
+	}
+	constraintsMu.RUnlock()
+	return seg[:begin] + ":^(?:" + expr + ")$", nil
+}
+
+// parsePattern translate constraints of the pattern, the constraint expression
+// should not contain '/'.
+func parsePattern(pattern string) (string, error) {
+	if strings.IndexByte(pattern, '<') < 0 {
+		return pattern, nil
+	}
+	segs := strings.Split(pattern, "/")
+	for i, seg := range segs {
+		if seg == "" || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		seg, err := parseConstraint(seg)
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", err.Error(), pattern)
+		}
+		segs[i] = seg
+	}
+	return strings.Join(segs, "/"), nil
+}
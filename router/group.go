@@ -1,36 +1,74 @@
 package router
 
-import "github.com/cosiner/roboot"
+import (
+	"strings"
+
+	"github.com/cosiner/roboot"
+)
 
 type groupRouter struct {
-	prefix string
+	prefix  string
+	filters []roboot.Filter
 	roboot.Router
 }
 
-func Group(r roboot.Router, pathPrefix string) roboot.Router {
+// Group create a router handles routes with the path prefix, the filters are applied to
+// all handlers of the group and nested groups.
+func Group(r roboot.Router, pathPrefix string, filters ...roboot.Filter) roboot.Router {
 	return groupRouter{
-		prefix: pathPrefix,
-		Router: r,
+		prefix:  pathPrefix,
+		filters: filters,
+		Router:  r,
+	}
+}
+
+func (g groupRouter) joinFilters(filters []roboot.Filter) []roboot.Filter {
+	if len(g.filters) == 0 {
+		return filters
 	}
+	joined := make([]roboot.Filter, 0, len(g.filters)+len(filters))
+	joined = append(joined, g.filters...)
+	return append(joined, filters...)
 }
 
-func (g groupRouter) Handle(path string, handler roboot.Handler) error {
-	return g.Router.Handle(g.prefix+path, handler)
+func (g groupRouter) Handle(path string, handler roboot.Handler, filters ...roboot.Filter) error {
+	return g.Router.Handle(g.prefix+path, handler, g.joinFilters(filters)...)
 }
 
 func (g groupRouter) Filter(path string, filters ...roboot.Filter) error {
 	return g.Router.Filter(g.prefix+path, filters...)
 }
 
-func (g groupRouter) Group(prefix string) roboot.Router {
+func (g groupRouter) Group(prefix string, filters ...roboot.Filter) roboot.Router {
 	return groupRouter{
-		prefix: g.prefix + prefix,
-		Router: g.Router,
+		prefix:  g.prefix + prefix,
+		filters: g.joinFilters(filters),
+		Router:  g.Router,
 	}
 }
 
+// Merge register routes of r through the group, so the group filters are applied to
+// the handlers as routes added by Handle.
 func (g groupRouter) Merge(prefix string, r roboot.Router) error {
-	return g.Router.Merge(g.prefix+prefix, r)
+	routes, ok := enumerateRoutes(r)
+	if !ok {
+		return errUnsupportedRouter
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	for _, route := range routes {
+		path := prefix + route.Pattern
+		if route.Handler != nil {
+			if err := g.Handle(path, route.Handler, route.HandlerFilters...); err != nil {
+				return err
+			}
+		}
+		if len(route.Filters) > 0 {
+			if err := g.Filter(path, route.Filters...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 func (g groupRouter) MatchHandler(path string) roboot.MatchedHandler {
@@ -44,3 +82,56 @@ func (g groupRouter) MatchFilters(path string) []roboot.MatchedFilter {
 func (g groupRouter) MatchHandlerAndFilters(path string) (roboot.MatchedHandler, []roboot.MatchedFilter) {
 	return g.Router.MatchHandlerAndFilters(g.prefix + path)
 }
+
+// Routes return routes of the underlying router under the group prefix, patterns are
+// kept with the prefix.
+func (g groupRouter) Routes() []roboot.Route {
+	routes, _ := g.routes()
+	return routes
+}
+
+// routes report false if the underlying router doesn't support enumeration.
+func (g groupRouter) routes() ([]roboot.Route, bool) {
+	all, ok := enumerateRoutes(g.Router)
+	if !ok {
+		return nil, false
+	}
+	var routes []roboot.Route
+	prefix := strings.TrimSuffix(g.prefix, "/")
+	for _, route := range all {
+		if strings.HasPrefix(route.Pattern, prefix) {
+			rest := route.Pattern[len(prefix):]
+			if rest == "" || rest[0] == '/' {
+				routes = append(routes, route)
+			}
+		}
+	}
+	return routes, true
+}
+
+func enumerateRoutes(r roboot.Router) ([]roboot.Route, bool) {
+	switch r := r.(type) {
+	case groupRouter:
+		return r.routes()
+	case roboot.RouteEnumerator:
+		return r.Routes(), true
+	default:
+		return nil, false
+	}
+}
+
+func (g groupRouter) RemoveHandler(path string) error {
+	remover, ok := g.Router.(roboot.RouteRemover)
+	if !ok {
+		return errUnsupportedRouter
+	}
+	return remover.RemoveHandler(g.prefix + path)
+}
+
+func (g groupRouter) RemoveFilters(path string) error {
+	remover, ok := g.Router.(roboot.RouteRemover)
+	if !ok {
+		return errUnsupportedRouter
+	}
+	return remover.RemoveFilters(g.prefix + path)
+}
@@ -3,24 +3,59 @@ package router
 import (
 	"errors"
 	"fmt"
+	"path"
+	"strings"
+	"sync"
 
 	"github.com/cosiner/roboot"
 	"github.com/cosiner/router"
 )
 
 type routeHandler struct {
-	handler roboot.Handler
-	filters []roboot.Filter
+	pattern        string
+	handler        roboot.Handler
+	handlerFilters []roboot.Filter
+	filters        []roboot.Filter
 }
 
+// TrailingSlash decide how paths with or without trailing slash are redirected, routes
+// are always matched regardless of the trailing slash.
+type TrailingSlash uint8
+
+const (
+	TrailingSlashIgnore TrailingSlash = iota
+	TrailingSlashStrip                // redirect /users/ to /users
+	TrailingSlashAppend               // redirect /users to /users/
+)
+
+type Options struct {
+	TrailingSlash TrailingSlash
+	// redirect paths contains empty, "." or ".." segments to the cleaned path
+	CleanPath bool
+	// redirect to the path in registered case if no route matches
+	CaseInsensitive bool
+}
+
+// serverRouter is safe for concurrent use, routes can be added or removed while serving.
 type serverRouter struct {
-	router router.Tree
+	mu      sync.RWMutex
+	router  router.Tree
+	options Options
+	// lower cased static segments to original patterns for case-insensitive matching
+	fold router.Tree
+
+	routes     []roboot.Route
+	routeIndex map[string]int
 }
 
 func New() roboot.Router {
 	return &serverRouter{}
 }
 
+func NewWithOptions(options Options) roboot.Router {
+	return &serverRouter{options: options}
+}
+
 func (r *serverRouter) addRoute(path string, fn func(routeHandler) (routeHandler, error)) error {
 	return r.router.Add(path, func(h interface{}) (interface{}, error) {
 		var (
@@ -38,18 +73,53 @@ func (r *serverRouter) addRoute(path string, fn func(routeHandler) (routeHandler
 	})
 }
 
-func (s *serverRouter) Handle(path string, handler roboot.Handler) error {
-	return s.addRoute(path, func(hd routeHandler) (routeHandler, error) {
+var errUnsupportedRouter = errors.New("unsupported router type")
+
+func (s *serverRouter) Handle(path string, handler roboot.Handler, filters ...roboot.Filter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handle(path, handler, filters)
+}
+
+func (s *serverRouter) handle(path string, handler roboot.Handler, filters []roboot.Filter) error {
+	pattern, err := parsePattern(path)
+	if err != nil {
+		return err
+	}
+	err = s.addRoute(pattern, func(hd routeHandler) (routeHandler, error) {
 		if hd.handler != nil {
 			return hd, fmt.Errorf("duplicate route handler: %s", path)
 		}
+		hd.pattern = path
 		hd.handler = handler
+		hd.handlerFilters = filters
 		return hd, nil
 	})
+	if err != nil {
+		return err
+	}
+	if s.options.CaseInsensitive {
+		// patterns only differ in case are reachable by exact matching, ignore the error
+		_ = s.fold.Add(foldPattern(pattern), pattern)
+	}
+	route := s.route(path, pattern)
+	route.Handler = handler
+	route.HandlerFilters = filters
+	return nil
 }
 
 func (s *serverRouter) Filter(path string, filters ...roboot.Filter) error {
-	return s.addRoute(path, func(hd routeHandler) (routeHandler, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filter(path, filters)
+}
+
+func (s *serverRouter) filter(path string, filters []roboot.Filter) error {
+	pattern, err := parsePattern(path)
+	if err != nil {
+		return err
+	}
+	err = s.addRoute(pattern, func(hd routeHandler) (routeHandler, error) {
 		c := cap(hd.filters)
 		if c == 0 {
 			hd.filters = filters
@@ -63,40 +133,153 @@ func (s *serverRouter) Filter(path string, filters ...roboot.Filter) error {
 		}
 		return hd, nil
 	})
+	if err != nil {
+		return err
+	}
+	route := s.route(path, pattern)
+	route.Filters = append(route.Filters, filters...)
+	return nil
+}
+
+func routeKey(pattern string) string {
+	return "/" + strings.Join(pathSegments(pattern), "/")
 }
 
-func (s *serverRouter) Group(prefix string) roboot.Router {
-	return Group(s, prefix)
+// route return the registry entry of the pattern, it's created if not exist. Patterns
+// differ only in slashes share the same entry as the tree.
+func (s *serverRouter) route(path, pattern string) *roboot.Route {
+	key := routeKey(pattern)
+	index, has := s.routeIndex[key]
+	if !has {
+		if s.routeIndex == nil {
+			s.routeIndex = make(map[string]int)
+		}
+		index = len(s.routes)
+		s.routeIndex[key] = index
+		s.routes = append(s.routes, roboot.Route{Pattern: path})
+	}
+	return &s.routes[index]
+}
+
+func (s *serverRouter) Routes() []roboot.Route {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	routes := make([]roboot.Route, len(s.routes))
+	for i, route := range s.routes {
+		route.HandlerFilters = append([]roboot.Filter(nil), route.HandlerFilters...)
+		route.Filters = append([]roboot.Filter(nil), route.Filters...)
+		routes[i] = route
+	}
+	return routes
+}
+
+func (s *serverRouter) Group(prefix string, filters ...roboot.Filter) roboot.Router {
+	return Group(s, prefix, filters...)
+}
+
+// Merge register all routes of r with the prefix, r must implement RouteEnumerator.
+// Routes added to r after merging are not visible.
+func (s *serverRouter) Merge(prefix string, r roboot.Router) error {
+	routes, ok := enumerateRoutes(r)
+	if !ok {
+		return errUnsupportedRouter
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addRoutes(strings.TrimSuffix(prefix, "/"), routes)
+}
+
+func (s *serverRouter) addRoutes(prefix string, routes []roboot.Route) error {
+	for _, route := range routes {
+		path := prefix + route.Pattern
+		if route.Handler != nil {
+			if err := s.handle(path, route.Handler, route.HandlerFilters); err != nil {
+				return err
+			}
+		}
+		if len(route.Filters) > 0 {
+			if err := s.filter(path, route.Filters); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
-func (s *serverRouter) Merge(path string, r roboot.Router) error {
-	switch sr := r.(type) {
-	case *serverRouter:
-		return s.router.Add(path, sr.router)
-	case groupRouter:
-		return errors.New("grouped router already be handled and should not to be handled again")
-	default:
-		return errors.New("unsupported rotuer type")
+// remove update the registry entry of path by fn, then rebuild the trees from the
+// registry since the tree doesn't support removing.
+func (s *serverRouter) remove(path string, fn func(route *roboot.Route) bool) error {
+	pattern, err := parsePattern(path)
+	if err != nil {
+		return err
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, has := s.routeIndex[routeKey(pattern)]
+	if !has || !fn(&s.routes[index]) {
+		return fmt.Errorf("route not found: %s", path)
+	}
+
+	routes := s.routes
+	s.router = router.Tree{}
+	s.fold = router.Tree{}
+	s.routes = nil
+	s.routeIndex = nil
+	return s.addRoutes("", routes)
+}
+
+// RemoveHandler unregister the handler and it's filters of the path, in-flight requests
+// are not affected.
+func (s *serverRouter) RemoveHandler(path string) error {
+	return s.remove(path, func(route *roboot.Route) bool {
+		if route.Handler == nil {
+			return false
+		}
+		route.Handler = nil
+		route.HandlerFilters = nil
+		return true
+	})
+}
+
+// RemoveFilters unregister all filters attached to the path by Filter.
+func (s *serverRouter) RemoveFilters(path string) error {
+	return s.remove(path, func(route *roboot.Route) bool {
+		if len(route.Filters) == 0 {
+			return false
+		}
+		route.Filters = nil
+		return true
+	})
 }
 
 func (s *serverRouter) parseMatchedHandler(result router.MatchResult) roboot.MatchedHandler {
 	if result.Handler == nil {
 		return roboot.MatchedHandler{}
 	}
+	hd := result.Handler.(routeHandler)
 	return roboot.MatchedHandler{
-		Handler: result.Handler.(routeHandler).handler,
+		Handler: hd.handler,
 		Params:  result.KeyValues,
+		Pattern: hd.pattern,
 	}
 }
 
 func (s *serverRouter) MatchHandler(path string) roboot.MatchedHandler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	result := s.router.MatchOne(path)
 	return s.parseMatchedHandler(result)
 }
 
-func (s *serverRouter) parseMatchedFilters(results []router.MatchResult) []roboot.MatchedFilter {
-	filters := make([]roboot.MatchedFilter, 0, len(results))
+// parseMatchedFilters return filters of all matched paths, then filters of the matched
+// handler.
+func (s *serverRouter) parseMatchedFilters(handler router.MatchResult, results []router.MatchResult) []roboot.MatchedFilter {
+	var handlerFilters []roboot.Filter
+	if handler.Handler != nil {
+		handlerFilters = handler.Handler.(routeHandler).handlerFilters
+	}
+	filters := make([]roboot.MatchedFilter, 0, len(results)+len(handlerFilters))
 	for i := range results {
 		for _, filter := range results[i].Handler.(routeHandler).filters {
 			filters = append(filters, roboot.MatchedFilter{
@@ -105,15 +288,116 @@ func (s *serverRouter) parseMatchedFilters(results []router.MatchResult) []roboo
 			})
 		}
 	}
+	for _, filter := range handlerFilters {
+		filters = append(filters, roboot.MatchedFilter{
+			Filter: filter,
+			Params: handler.KeyValues,
+		})
+	}
 	return filters
 }
 
 func (s *serverRouter) MatchFilters(path string) []roboot.MatchedFilter {
-	results := s.router.MatchAll(path)
-	return s.parseMatchedFilters(results)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, f := s.router.MatchBoth(path)
+	return s.parseMatchedFilters(h, f)
 }
 
 func (s *serverRouter) MatchHandlerAndFilters(path string) (roboot.MatchedHandler, []roboot.MatchedFilter) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	h, f := s.router.MatchBoth(path)
-	return s.parseMatchedHandler(h), s.parseMatchedFilters(f)
+	return s.parseMatchedHandler(h), s.parseMatchedFilters(h, f)
+}
+
+func pathSegments(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+}
+
+// foldPattern lower case static segments of the pattern, parameter segments are kept as is.
+func foldPattern(pattern string) string {
+	segs := pathSegments(pattern)
+	for i, seg := range segs {
+		if seg[0] != ':' && seg[0] != '*' {
+			segs[i] = strings.ToLower(seg)
+		} else if index := strings.IndexByte(seg[1:], ':'); index >= 0 {
+			// the path is lower cased for matching, so the parameter regexp should ignore
+			// case, the original value is validated by the exact matching later
+			index++
+			segs[i] = seg[:index+1] + "(?i)" + seg[index+1:]
+		}
+	}
+	return "/" + strings.Join(segs, "/")
+}
+
+func cleanPath(p string) string {
+	cleaned := path.Clean("/" + p)
+	if cleaned != "/" && strings.HasSuffix(p, "/") {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// matchFold match path case-insensitively, the result path use static segments of
+// the pattern and parameter values of the path.
+func (s *serverRouter) matchFold(p string) (string, bool) {
+	result := s.fold.MatchOne(strings.ToLower(p))
+	if result.Handler == nil {
+		return "", false
+	}
+	var (
+		patternSegs = pathSegments(result.Handler.(string))
+		pathSegs    = pathSegments(p)
+		segs        = make([]string, 0, len(pathSegs))
+	)
+	for i, seg := range patternSegs {
+		if seg[0] == '*' {
+			segs = append(segs, pathSegs[i:]...)
+			break
+		}
+		if i >= len(pathSegs) {
+			return "", false
+		}
+		if seg[0] == ':' {
+			seg = pathSegs[i]
+		}
+		segs = append(segs, seg)
+	}
+	matched := "/" + strings.Join(segs, "/")
+	if matched != "/" && strings.HasSuffix(p, "/") {
+		matched += "/"
+	}
+	if s.router.MatchOne(matched).Handler == nil {
+		return "", false
+	}
+	return matched, true
+}
+
+func (s *serverRouter) RedirectPath(p string, matched bool) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	target := p
+	if s.options.CleanPath {
+		target = cleanPath(target)
+	}
+	switch s.options.TrailingSlash {
+	case TrailingSlashStrip:
+		if trimmed := strings.TrimRight(target, "/"); trimmed != "" {
+			target = trimmed
+		}
+	case TrailingSlashAppend:
+		if !strings.HasSuffix(target, "/") {
+			target += "/"
+		}
+	}
+	if target != p && (target == "/" || s.router.MatchOne(target).Handler != nil) {
+		return target, true
+	}
+	if !matched && s.options.CaseInsensitive {
+		if folded, ok := s.matchFold(target); ok && folded != p {
+			return folded, true
+		}
+	}
+	return "", false
 }